@@ -3,13 +3,20 @@
 // declaration    → classDecl
 //                | funDecl
 //                | varDecl
+//                | constDecl
+//                | importDecl
 //                | statement ;
-// classDecl      → "class" IDENTIFIER ( "<" IDENTIFIER )? "{" function* "}" ;
+// classDecl      → "class" IDENTIFIER ( "<" IDENTIFIER )? "{" ( field | function )* "}" ;
+// field          → IDENTIFIER "=" expression ";" ;
 // funDecl        → "fun" function ;
 // function       → IDENTIFIER "(" parameters? ")" block ;
-// parameters     → IDENTIFIER ( "," IDENTIFIER )* ;
+// parameters     → IDENTIFIER ( "," IDENTIFIER )* ( "," "..." IDENTIFIER )? ","?
+//                | "..." IDENTIFIER ","? ;
 // varDecl        → "var" IDENTIFIER ( "=" expression )? ";" ;
+// constDecl      → "const" IDENTIFIER "=" expression ";" ;
+// importDecl     → "import" STRING ";" ;
 // statement      → exprStmt
+//                | emptyStmt
 //                | forStmt
 //                | ifStmt
 //                | printStmt
@@ -17,14 +24,17 @@
 //                | whileStmt
 //                | block ;
 // exprStmt       → expression ";" ;
-// forStmt        → "for" "(" ( varDecl | exprStmt | ";" ) expression? ";" expression? ")" statement ;
+// emptyStmt      → ";" ;
+// forStmt        → "for" "(" ( varDecl | exprStmt | ";" ) expression? ";" expression? ")" statement
+//                | "for" "(" IDENTIFIER "in" expression ")" statement ;
 // ifStmt         → "if" "(" expression ")" statement ( "else" statement )? ;
-// printStmt      → "print" expression ";" ;
+// printStmt      → "print" assignment ( "," assignment )* ";" ;
 // returnStmt     → "return" expression? ";" ;
 // whileStmt      → "while" "(" expression ")" statement ;
 // block          → "{" declaration* "}" ;
 //
-// expression     → assignment ;
+// expression     → comma ;
+// comma          → assignment ( "," assignment )* ; //only with the -comma flag
 // assignment     → ( call "." )? IDENTIFIER "=" assignment
 //                | logic_or ;
 // logic_or       → logic_and ( "or" logic_and )* ;
@@ -35,9 +45,10 @@
 // factor         → unary ( ( "/" | "*" ) unary )* ;
 // unary          → ( "!" | "-" ) unary | call ;
 // call           → primary ( "(" arguments? ")" | "." IDENTIFIER )* ;
-// arguments      → expression ( "," expression )* ;
+// arguments      → assignment ( "," assignment )* ","? ;
 // primary        → NUMBER | STRING | "true" | "false" | "nil" | "(" expression ")"
-//                | IDENTIFIER | "super" "." IDENTIFIER ;
+//                | IDENTIFIER | "super" "." IDENTIFIER
+//                | "object" "{" field* "}" ;
 
 package main
 
@@ -70,6 +81,7 @@ func (p *Program) String() string {
 type ClassDecl struct {
 	name       string
 	superclass *VariableExpr
+	fields     []*VarDecl //defaults set on each new instance, before init runs
 	methods    []*FunDecl
 }
 
@@ -77,47 +89,57 @@ func (cd *ClassDecl) String() string {
 	sb := strings.Builder{}
 	sb.WriteString("class " + cd.name)
 	if cd.superclass != nil {
-		sb.WriteString("< " + cd.superclass.name.Lexeme)
+		sb.WriteString(" < " + cd.superclass.name.Lexeme)
 	}
 	sb.WriteString(" {\n")
+	for _, field := range cd.fields {
+		sb.WriteString(indent(field.name+" = "+field.expr.String()+";") + "\n")
+	}
 	for _, method := range cd.methods {
-		sb.WriteString("\t" + method.String() + "\n")
+		sb.WriteString(indent(method.String()) + "\n")
 	}
 	sb.WriteString("}")
 	return sb.String()
 }
 
 type FunDecl struct {
-	name   string
-	params []Token
-	body   []Stmt //not a block so the parameters can be more easily added
+	name     string
+	params   []Token
+	variadic bool   //the last parameter collects any extra arguments into a list
+	body     []Stmt //not a block so the parameters can be more easily added
 }
 
 func (fd *FunDecl) String() string {
 	sb := strings.Builder{}
 	sb.WriteString("fun " + fd.name + "(")
-	if len(fd.params) > 0 {
-		sb.WriteString(fd.params[0].Lexeme)
-		for _, arg := range fd.params[1:] {
-			sb.WriteString(", " + arg.Lexeme)
+	for i, param := range fd.params {
+		if i > 0 {
+			sb.WriteString(", ")
 		}
+		if fd.variadic && i == len(fd.params)-1 {
+			sb.WriteString("...")
+		}
+		sb.WriteString(param.Lexeme)
 	}
 	sb.WriteString(") ")
-	for _, stmt := range fd.body {
-		sb.WriteString(stmt.String() + "\n")
-	}
+	sb.WriteString(braced(fd.body))
 	return sb.String()
 }
 
 type VarDecl struct {
-	name string
-	expr Expr
+	name    string
+	expr    Expr
+	isConst bool
 }
 
 func (vd *VarDecl) String() string {
 	sb := strings.Builder{}
 
-	sb.WriteString("var " + vd.name)
+	if vd.isConst {
+		sb.WriteString("const " + vd.name)
+	} else {
+		sb.WriteString("var " + vd.name)
+	}
 	if vd.expr != nil {
 		sb.WriteString(" = " + vd.expr.String())
 	}
@@ -133,6 +155,13 @@ func (es *ExprStmt) String() string {
 	return es.expr.String()
 }
 
+// A lone ';', e.g. the body of `for (...) ;`
+type EmptyStmt struct{}
+
+func (es *EmptyStmt) String() string {
+	return ""
+}
+
 // For statements de-sugar into while statements
 
 type IfStmt struct {
@@ -143,20 +172,38 @@ type IfStmt struct {
 
 func (is *IfStmt) String() string {
 	sb := strings.Builder{}
-	sb.WriteString("if (" + is.condition.String() + ") ") // extra space in case a block is next
-	sb.WriteString(is.thenBranch.String())
-	if is.elseBranch != nil {
-		sb.WriteString("else " + is.elseBranch.String())
+	sb.WriteString("if (" + is.condition.String() + ")")
+	sb.WriteString(nested(is.thenBranch))
+	if is.elseBranch == nil {
+		return sb.String()
+	}
+
+	if _, ok := is.thenBranch.(*Block); ok {
+		sb.WriteString(" else")
+	} else {
+		sb.WriteString("\nelse")
+	}
+	if _, ok := is.elseBranch.(*IfStmt); ok {
+		// Keep `else if` chains flat
+		sb.WriteString(" " + is.elseBranch.String())
+	} else {
+		sb.WriteString(nested(is.elseBranch))
 	}
 	return sb.String()
 }
 
 type PrintStmt struct {
-	expr Expr
+	keyword Token //for the line of an error from toString
+	exprs   []Expr
 }
 
 func (ps *PrintStmt) String() string {
-	return "print " + ps.expr.String()
+	sb := strings.Builder{}
+	sb.WriteString("print " + ps.exprs[0].String())
+	for _, expr := range ps.exprs[1:] {
+		sb.WriteString(", " + expr.String())
+	}
+	return sb.String()
 }
 
 type ReturnStmt struct {
@@ -178,37 +225,98 @@ type WhileStmt struct {
 }
 
 func (ws *WhileStmt) String() string {
-	return fmt.Sprintf("while (%s) %s", ws.condition, ws.body)
+	return fmt.Sprintf("while (%s)%s", ws.condition, nested(ws.body))
+}
+
+// Unlike a for loop, it isn't desugared, since it loops over a list
+type ForEachStmt struct {
+	name     Token
+	iterable Expr
+	body     Stmt
+}
+
+func (fs *ForEachStmt) String() string {
+	return fmt.Sprintf("for (%s in %s)%s", fs.name.Lexeme, fs.iterable, nested(fs.body))
+}
+
+// The path is resolved against the importing file's directory when parsing
+type ImportDecl struct {
+	path Token
+	file string
+}
+
+func (id *ImportDecl) String() string {
+	return "import " + id.path.Lexeme
 }
 
 type Block struct {
 	decls []Stmt
 }
 
-// TODO: add indentation based on depth using a variable
 func (b *Block) String() string {
+	return braced(b.decls)
+}
+
+// Helpers for printing nested statements. Every line of a nested statement
+// is indented, so each level of nesting adds one more indentation.
+const indentation = "    "
+
+func indent(s string) string {
+	return indentation + strings.ReplaceAll(s, "\n", "\n"+indentation)
+}
+
+// The statements between braces, one per line
+func braced(stmts []Stmt) string {
+	if len(stmts) == 0 {
+		return "{}"
+	}
+
 	sb := strings.Builder{}
 	sb.WriteString("{\n")
-	for _, decl := range b.decls {
-		sb.WriteString("    " + decl.String() + "\n")
+	for _, stmt := range stmts {
+		sb.WriteString(indent(stmt.String()) + "\n")
 	}
 	sb.WriteByte('}')
 	return sb.String()
 }
 
+// The body of an if or while. A block stays on the same line, anything else
+// goes on its own indented line.
+func nested(body Stmt) string {
+	if _, ok := body.(*Block); ok {
+		return " " + body.String()
+	}
+	return "\n" + indent(body.String())
+}
+
 type Expr interface {
 	ASTNode
 	Evaluate(lox *Interpreter) Object
 	String() string
 }
 
+// Evaluates each expression left to right, and is the value of the last one
+type CommaExpr struct {
+	exprs []Expr
+}
+
+func (ce *CommaExpr) String() string {
+	sb := strings.Builder{}
+	sb.WriteString("(,")
+	for _, expr := range ce.exprs {
+		sb.WriteString(" " + expr.String())
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
+
 type AssignmentExpr struct {
-	name string
+	name Token
 	expr Expr
 }
 
 func (ae *AssignmentExpr) String() string {
-	return fmt.Sprintf("%s = %s", ae.name, ae.expr)
+	return fmt.Sprintf("%s = %s", ae.name.Lexeme, ae.expr)
 }
 
 type SetExpr struct {
@@ -270,8 +378,8 @@ func (ue *UnaryExpr) String() string {
 
 type CallExpr struct {
 	callee Expr
-	// paren	Token // the book has this, I'm not sure why atm
-	args []Expr
+	paren  Token //the closing paren, for the line in runtime errors
+	args   []Expr
 }
 
 func (ce *CallExpr) String() string {
@@ -328,5 +436,20 @@ type SuperExpr struct {
 }
 
 func (se *SuperExpr) String() string {
-	return fmt.Sprintf("%s.%s", se.keyword, se.method)
+	return fmt.Sprintf("%s.%s", se.keyword.Lexeme, se.method.Lexeme)
+}
+
+// An instance of an anonymous class, which only has fields
+type ObjectExpr struct {
+	fields []*VarDecl
+}
+
+func (oe *ObjectExpr) String() string {
+	sb := strings.Builder{}
+	sb.WriteString("object {")
+	for _, field := range oe.fields {
+		sb.WriteString(fmt.Sprintf(" %s = %s;", field.name, field.expr))
+	}
+	sb.WriteString(" }")
+	return sb.String()
 }
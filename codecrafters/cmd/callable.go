@@ -1,53 +1,123 @@
 package main
 
+import (
+	"fmt"
+	"slices"
+)
+
+// Arity is the number of arguments a call needs. A variadic callable accepts
+// at least that many, while any other must be called with exactly that many.
 type Callable interface {
 	Call(lox *Interpreter, args []Object) (ret Object)
 	Arity() int
+	Variadic() bool
+}
+
+/* A call in a return statement, like `return f(n - 1);`, is returned as a
+ * tailCall instead of being made. The function that returned it then makes the
+ * call in a loop, after its own environment is done with, so the stack doesn't
+ * grow. This only works for a call that is the whole return value, so
+ * `return (f());` or `return 1 + f();` still use the stack.
+ */
+type tailCall struct {
+	callee Callable
+	args   []Object
 }
 
+// Never seen by a program, since Call always makes the call
+func (tc *tailCall) Type() ObjectType { return Function }
+func (tc *tailCall) String() string   { return "<tail call>" }
+
 func (f *LoxFunction) Call(lox *Interpreter, args []Object) (ret Object) {
+	lox.depth++
+	if lox.maxDepth > 0 && lox.depth > lox.maxDepth {
+		runtimeError("Stack overflow.")
+	}
+	defer func() { lox.depth-- }()
+
+	for {
+		lox.checkTime()
+		retVal := f.run(lox, args)
+		tc, ok := retVal.(*tailCall)
+		if !ok {
+			return retVal
+		}
+
+		next, ok := tc.callee.(*LoxFunction)
+		if !ok {
+			// Natives and classes don't return tail calls
+			return tc.callee.Call(lox, tc.args)
+		}
+		f, args = next, tc.args
+	}
+}
+
+// Runs the body once, which might return a tail call
+func (f *LoxFunction) run(lox *Interpreter, args []Object) Object {
+	lox.stats.calls++
 	oldScope := lox.env
-	lox.env = NewEnvironment(f.closure)
+	lox.env = lox.newEnvironment(f.closure)
 	defer func() {
+		lox.releaseEnvironment(lox.env)
 		lox.env = oldScope
 	}()
 
-	for i, arg := range args {
+	fixed := f.Arity()
+	for i, arg := range args[:fixed] {
 		lox.env.Define(f.funDecl.params[i].Lexeme, arg)
 	}
+	if f.funDecl.variadic {
+		rest := slices.Clone(args[fixed:])
+		lox.env.Define(f.funDecl.params[fixed].Lexeme, &LoxList{rest})
+	}
 
 	for _, stmt := range f.funDecl.body {
 		if retVal, ret := stmt.Run(lox); ret {
 			if f.isInit {
-				return lox.env.Get("this")
+				// Only reachable with -no-resolve. The call is still made, but
+				// the initializer returns the instance instead of its result.
+				if tc, ok := retVal.(*tailCall); ok {
+					tc.callee.Call(lox, tc.args)
+				}
+				return f.closure.values["this"]
 			}
 			return retVal
 		}
 	}
 
+	// bind defined "this" in the closure
 	if f.isInit {
-		return f.closure.Get("this")
+		return f.closure.values["this"]
 	}
 	return &LoxNil{}
 }
 
+// The rest parameter doesn't count towards the arity
 func (f *LoxFunction) Arity() int {
+	if f.funDecl.variadic {
+		return len(f.funDecl.params) - 1
+	}
 	return len(f.funDecl.params)
 }
 
+func (f *LoxFunction) Variadic() bool {
+	return f.funDecl.variadic
+}
+
 // Adds a new environment where "this" is a variable holding the instance
-func (f *LoxFunction) bind(loxInstance *LoxInstance) *LoxFunction {
-	env := NewEnvironment(f.closure)
+func (f *LoxFunction) bind(lox *Interpreter, loxInstance *LoxInstance) *LoxFunction {
+	env := lox.newEnvironment(f.closure)
 	env.Define("this", loxInstance)
 	return &LoxFunction{funDecl: f.funDecl, closure: env, isInit: f.isInit}
 }
 
 func (c *LoxClass) Call(lox *Interpreter, args []Object) (ret Object) {
-	instance := &LoxInstance{loxClass: *c, fields: make(map[string]Object)}
+	instance := &LoxInstance{loxClass: c, fields: make(map[string]Object)}
+	c.initFields(lox, instance)
 
 	// If there is an initializer, call it before returning the instance
 	if initializer := c.FindMethod("init"); initializer != nil {
-		initializer.bind(instance).Call(lox, args)
+		initializer.bind(lox, instance).Call(lox, args)
 	}
 	return instance
 }
@@ -59,27 +129,76 @@ func (c *LoxClass) Arity() int {
 	return 0
 }
 
+func (c *LoxClass) Variadic() bool {
+	if initializer := c.FindMethod("init"); initializer != nil {
+		return initializer.Variadic()
+	}
+	return false
+}
+
+// Sets the field defaults, starting with the superclass's so a subclass can
+// override them. They're evaluated like a method body, with "this" bound.
+func (c *LoxClass) initFields(lox *Interpreter, instance *LoxInstance) {
+	if c.superclass != nil {
+		c.superclass.initFields(lox, instance)
+	}
+	if len(c.fields) == 0 {
+		return
+	}
+
+	oldScope := lox.env
+	lox.env = lox.newEnvironment(c.closure)
+	lox.env.Define("this", instance)
+	defer func() {
+		lox.releaseEnvironment(lox.env)
+		lox.env = oldScope
+	}()
+
+	for _, field := range c.fields {
+		instance.fields[field.name] = field.expr.Evaluate(lox)
+	}
+}
+
+// Classes can't change after they're declared, so a lookup up the superclass
+// chain only has to happen once per name. Misses are cached too.
 func (c *LoxClass) FindMethod(name string) *LoxFunction {
-	if m, ok := c.methods[name]; ok {
+	if m, ok := c.cache[name]; ok {
 		return m
 	}
-	if c.superclass != nil {
-		if m := c.superclass.FindMethod(name); m != nil {
-			return m
-		}
+
+	m := c.methods[name]
+	if m == nil && c.superclass != nil {
+		m = c.superclass.FindMethod(name)
 	}
-	return nil
+	c.cache[name] = m
+	return m
 }
 
-func (i *LoxInstance) Get(name string) Object {
-	if field, ok := i.fields[name]; ok {
+// Takes the token so an undefined property error has its line
+func (i *LoxInstance) Get(lox *Interpreter, name Token) Object {
+	if field, ok := i.fields[name.Lexeme]; ok {
 		return field
 	}
-	method := i.loxClass.FindMethod(name)
+	method := i.loxClass.FindMethod(name.Lexeme)
 	if method == nil {
-		runtimeError("Undefined property: " + name)
+		runtimeErrorAt(name.Line, fmt.Sprintf("Undefined property '%s'.", name.Lexeme))
+	}
+	return method.bind(lox, i)
+}
+
+// Calls the class's toString method, if it has one that takes no arguments. An
+// error is reported at the line showing the instance, since that's the call.
+func (i *LoxInstance) ToString(lox *Interpreter, line int) (string, bool) {
+	method := i.loxClass.FindMethod("toString")
+	if method == nil || method.Arity() != 0 {
+		return "", false
+	}
+
+	str, ok := IsString(method.bind(lox, i).Call(lox, []Object{}))
+	if !ok {
+		runtimeErrorAt(line, "toString must return a string.")
 	}
-	return method.bind(i)
+	return str, true
 }
 
 func (i *LoxInstance) Set(name string, value Object) {
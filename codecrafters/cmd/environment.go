@@ -1,8 +1,11 @@
 package main
 
+import "fmt"
+
 type Environment struct {
-	parent *Environment
-	values map[string]Object
+	parent   *Environment
+	values   map[string]Object
+	captured bool //a closure refers to it, so it can't be reused
 }
 
 func NewEnvironment(parent *Environment) *Environment {
@@ -12,6 +15,41 @@ func NewEnvironment(parent *Environment) *Environment {
 	}
 }
 
+// A closure keeps its whole chain of environments alive
+func (e *Environment) capture() {
+	for env := e; env != nil && !env.captured; env = env.parent {
+		env.captured = true
+	}
+}
+
+/* Allocating an environment for every call and block is most of the time spent
+ * in call-heavy programs, so they're reused once their scope ends. Clearing a
+ * map keeps the space it has already grown.
+ *
+ * Every environment is made here, so -stats counts them all. One that is kept,
+ * like a bound method's, is just never released.
+ */
+func (lox *Interpreter) newEnvironment(parent *Environment) *Environment {
+	lox.stats.environments++
+	if n := len(lox.envPool); n > 0 {
+		env := lox.envPool[n-1]
+		lox.envPool = lox.envPool[:n-1]
+		env.parent = parent
+		return env
+	}
+	lox.stats.allocated++
+	return NewEnvironment(parent)
+}
+
+func (lox *Interpreter) releaseEnvironment(env *Environment) {
+	if env.captured {
+		return
+	}
+	clear(env.values)
+	env.parent = nil
+	lox.envPool = append(lox.envPool, env)
+}
+
 func (e *Environment) Define(name string, obj Object) {
 	// Overwrite if it already exists
 	// Nice for a REPL (you don't want to mentally track every declaration)
@@ -20,23 +58,24 @@ func (e *Environment) Define(name string, obj Object) {
 	e.values[name] = obj
 }
 
-func (e *Environment) Assign(name string, obj Object) {
+// Assign and Get take the token so an undefined variable error has its line
+func (e *Environment) Assign(name Token, obj Object) {
 	for env := e; env != nil; env = env.parent {
-		if _, found := env.values[name]; found {
-			env.values[name] = obj
+		if _, found := env.values[name.Lexeme]; found {
+			env.values[name.Lexeme] = obj
 			return
 		}
 	}
-	runtimeError("Undefined variable: " + name)
+	runtimeErrorAt(name.Line, fmt.Sprintf("Undefined variable '%s'.", name.Lexeme))
 }
 
-func (e Environment) Get(name string) Object {
-	value, found := e.values[name]
+func (e Environment) Get(name Token) Object {
+	value, found := e.values[name.Lexeme]
 	if !found && e.parent != nil {
 		return e.parent.Get(name)
 	}
 	if !found {
-		runtimeError("Undefined variable: " + name)
+		runtimeErrorAt(name.Line, fmt.Sprintf("Undefined variable '%s'.", name.Lexeme))
 	}
 	return value
 }
@@ -44,6 +83,9 @@ func (e Environment) Get(name string) Object {
 func (e Environment) Ancestor(distance int) *Environment {
 	env := &e
 	for range distance {
+		if env == nil {
+			break
+		}
 		env = env.parent
 	}
 	return env
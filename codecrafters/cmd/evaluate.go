@@ -4,15 +4,24 @@ import (
 	"fmt"
 	"os"
 	"strconv"
-	"time"
 )
 
+func (ce *CommaExpr) Evaluate(lox *Interpreter) Object {
+	var obj Object
+	for _, expr := range ce.exprs {
+		obj = expr.Evaluate(lox)
+	}
+	return obj
+}
+
 func (ae *AssignmentExpr) Evaluate(lox *Interpreter) Object {
 	obj := ae.expr.Evaluate(lox)
 
 	distance, isLocal := lox.locals[ae]
-	if isLocal {
-		lox.AssignAt(distance, ae.name, obj)
+	if lox.locals == nil {
+		lox.env.Assign(ae.name, obj)
+	} else if isLocal {
+		lox.AssignAt(distance, ae.name.Lexeme, obj)
 	} else {
 		lox.globals.Assign(ae.name, obj)
 	}
@@ -65,11 +74,12 @@ func (ue *UnaryExpr) Evaluate(lox *Interpreter) Object {
 }
 
 func (ce *CallExpr) Evaluate(lox *Interpreter) Object {
-	// Couldn't figure out a cleaner way to bolt on native functions.
-	if ie, ok := ce.callee.(*VariableExpr); ok && ie.name.Lexeme == "clock" {
-		return &LoxNumber{float64(time.Now().Unix())}
-	}
+	callable, args := ce.prepare(lox)
+	return callable.Call(lox, args)
+}
 
+// Everything for a call except calling it, so a tail call can be made later
+func (ce *CallExpr) prepare(lox *Interpreter) (Callable, []Object) {
 	callee := ce.callee.Evaluate(lox)
 
 	var callable Callable
@@ -78,12 +88,20 @@ func (ce *CallExpr) Evaluate(lox *Interpreter) Object {
 		callable = callee.(*LoxFunction)
 	case *LoxClass:
 		callable = callee.(*LoxClass)
+	case *LoxNative:
+		callable = callee.(*LoxNative)
 	default:
-		runtimeError("Can only call functions and classes.")
+		runtimeErrorAt(ce.paren.Line, "Can only call functions and classes.")
 	}
 
-	if len(ce.args) != callable.Arity() {
-		runtimeError(fmt.Sprintf(
+	if callable.Variadic() {
+		if len(ce.args) < callable.Arity() {
+			runtimeErrorAt(ce.paren.Line, fmt.Sprintf(
+				"Expected at least %d arguments but got %d.", callable.Arity(), len(ce.args),
+			))
+		}
+	} else if len(ce.args) != callable.Arity() {
+		runtimeErrorAt(ce.paren.Line, fmt.Sprintf(
 			"Expected %d arguments but got %d.", callable.Arity(), len(ce.args),
 		))
 	}
@@ -93,7 +111,9 @@ func (ce *CallExpr) Evaluate(lox *Interpreter) Object {
 		args = append(args, arg.Evaluate(lox))
 	}
 
-	return callable.Call(lox, args)
+	// Set after the arguments, which can make calls of their own
+	lox.callLine = ce.paren.Line
+	return callable, args
 }
 
 func (ge *GetExpr) Evaluate(lox *Interpreter) Object {
@@ -101,14 +121,14 @@ func (ge *GetExpr) Evaluate(lox *Interpreter) Object {
 
 	inst, ok := IsInstance(obj)
 	if !ok {
-		runtimeError("Only instances have properties.")
+		runtimeErrorAt(ge.name.Line, "Only instances have properties.")
 	}
 
-	return inst.Get(ge.name.Lexeme)
+	return inst.Get(lox, ge.name)
 }
 
 func (te *ThisExpr) Evaluate(lox *Interpreter) Object {
-	return lox.LookUpVariable(te, te.keyword.Lexeme)
+	return lox.LookUpVariable(te, te.keyword)
 }
 
 func (be *BinaryExpr) Evaluate(lox *Interpreter) Object {
@@ -122,6 +142,9 @@ func (be *BinaryExpr) Evaluate(lox *Interpreter) Object {
 		if aok && bok {
 			return &LoxString{a + b}
 		}
+		if lox.coerce && aok != bok {
+			return &LoxString{display(lox, left, be.op.Line) + display(lox, right, be.op.Line)}
+		}
 
 		c, cok := IsNumber(left)
 		d, dok := IsNumber(right)
@@ -129,7 +152,7 @@ func (be *BinaryExpr) Evaluate(lox *Interpreter) Object {
 			return &LoxNumber{c + d}
 		}
 
-		runtimeError("Operands must be two numbers or two strings.")
+		runtimeErrorAt(be.op.Line, "Operands must be two numbers or two strings.")
 
 	case MINUS:
 		a, b := assertNumbers(left, right)
@@ -184,26 +207,38 @@ func (le *LiteralExpr) Evaluate(lox *Interpreter) Object {
 	case STRING:
 		return &LoxString{le.token.Literal}
 	case NUMBER:
-		n, _ := strconv.ParseFloat(le.token.Literal, 64)
+		// The scanner already reported any number that doesn't parse
+		n, err := strconv.ParseFloat(le.token.Literal, 64)
+		if err != nil {
+			panic("unreachable: invalid number literal " + le.token.Literal)
+		}
 		return &LoxNumber{n}
 	}
 	panic("unreachable: LiteralExpression.Evaluate(lox)")
 }
 
 func (ve *VariableExpr) Evaluate(lox *Interpreter) Object {
-	return lox.LookUpVariable(ve, ve.name.Lexeme)
+	return lox.LookUpVariable(ve, ve.name)
 }
 
 func (se *SuperExpr) Evaluate(lox *Interpreter) Object {
-	distance := lox.locals[se]
-	superclass := lox.GetAt(distance, "super").(*LoxClass)
-	instance := lox.GetAt(distance-1, "this").(*LoxInstance) //look an environment nearer for this
+	var superclass *LoxClass
+	var instance *LoxInstance
+	if lox.locals == nil {
+		this := Token{Type: THIS, Lexeme: "this", Line: se.keyword.Line}
+		superclass = lox.env.Get(se.keyword).(*LoxClass)
+		instance = lox.env.Get(this).(*LoxInstance)
+	} else {
+		distance := lox.locals[se]
+		superclass = lox.GetAt(distance, "super").(*LoxClass)
+		instance = lox.GetAt(distance-1, "this").(*LoxInstance) //look an environment nearer for this
+	}
 
 	method := superclass.FindMethod(se.method.Lexeme)
 	if method == nil {
-		runtimeError("Undefined property: " + se.method.Lexeme)
+		runtimeErrorAt(se.method.Line, fmt.Sprintf("Undefined property '%s'.", se.method.Lexeme))
 	}
-	return method.bind(instance)
+	return method.bind(lox, instance)
 }
 
 // --------------- Helper Functions --------------- //
@@ -247,7 +282,8 @@ func isEqual(left, right Object) bool {
 		return b1 == b2
 	}
 
-	return false
+	// Instances, classes, and functions are only equal to the same object
+	return left == right
 }
 
 func assertNumber(obj Object) float64 {
@@ -258,7 +294,36 @@ func assertNumber(obj Object) float64 {
 	return n
 }
 
+func (oe *ObjectExpr) Evaluate(lox *Interpreter) Object {
+	class := &LoxClass{
+		name:    "object",
+		methods: map[string]*LoxFunction{},
+		cache:   map[string]*LoxFunction{},
+	}
+	instance := &LoxInstance{loxClass: class, fields: make(map[string]Object, len(oe.fields))}
+	for _, field := range oe.fields {
+		instance.fields[field.name] = field.expr.Evaluate(lox)
+	}
+	return instance
+}
+
+// Set when running more than one file, so an error can say which one failed
+var currentFile string
+
+func exitWithError(code int) {
+	if currentFile != "" {
+		fmt.Fprintf(os.Stderr, "in %s\n", currentFile)
+	}
+	os.Exit(code)
+}
+
 func runtimeError(message string) {
 	fmt.Fprintln(os.Stderr, message)
-	os.Exit(70)
+	exitWithError(70)
+}
+
+// Includes the line the error happened on, like the reference does
+func runtimeErrorAt(line int, message string) {
+	fmt.Fprintf(os.Stderr, "%s\n[line %d]\n", message, line)
+	exitWithError(70)
 }
@@ -1,61 +1,227 @@
 package main
 
+import (
+	"cmp"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
 type Interpreter struct {
-	tokens  []Token
-	ast     Program
-	globals Environment
-	env     *Environment // a pointer to the current environment
-	locals  map[Expr]int // side table for how many environments up to look
+	file       string // the absolute path of the file being run
+	tokens     []Token
+	ast        Program
+	globals    Environment
+	env        *Environment  // a pointer to the current environment
+	locals     map[Expr]int  // side table for how many environments up to look
+	globalRefs map[Expr]bool // variables the resolver decided are globals
+	resolver   *Resolver
+	envPool    []*Environment
+	importing  map[string]bool // files partway through running, to catch cyclic imports
+	imported   map[string]bool // files already run, which importing again does nothing
+
+	commaOperator bool
+	strictScopes  bool
+	warnings      bool
+	coerce        bool
+	depth         int          // how many calls deep the program currently is
+	callLine      int          // the line of the latest call, for errors from natives
+	maxDepth      int          // report a stack overflow past this depth, instead of crashing Go
+	outOfTime     *atomic.Bool // set by a timer when there is a time limit
+	stats         Stats
+	random        *rand.Rand
+}
+
+// Counts of what a program did, for seeing what is costly
+type Stats struct {
+	tokens       int // from every file, including imports
+	environments int // every scope, including reused ones
+	allocated    int // environments that couldn't be reused
+	calls        int
 }
 
 func (lox *Interpreter) Scan(filename string) bool {
+	lox.file, _ = filepath.Abs(filename)
 	scanner := Scanner{}
 	scanner.init(filename)
 	lox.tokens = scanner.scan()
+	lox.stats.tokens += len(lox.tokens)
 	return scanner.lexicalError
 }
 
 func (lox *Interpreter) Parse() {
-	parser := Parser{tokens: lox.tokens}
+	parser := Parser{tokens: lox.tokens, dir: filepath.Dir(lox.file), commaOperator: lox.commaOperator}
 	lox.ast = parser.program()
 }
 
+// The resolver is kept between files, so it knows which globals are const
 func (lox *Interpreter) Resolve() {
-	resolver := NewResolver()
-	lox.ast.resolve(resolver)
-	lox.locals = resolver.locals
+	if lox.resolver == nil {
+		lox.resolver = NewResolver()
+		lox.resolver.strictScopes = lox.strictScopes
+		lox.resolver.warnings = lox.warnings
+	}
+	lox.ast.resolve(lox.resolver)
+	lox.locals = lox.resolver.locals
+	lox.globalRefs = lox.resolver.globalRefs
 }
 
+// Prints how far up each local is, sorted by where it is in the source since
+// map order is random
+func (lox *Interpreter) PrintLocals() {
+	exprs := make([]Expr, 0, len(lox.locals))
+	for expr := range lox.locals {
+		exprs = append(exprs, expr)
+	}
+	slices.SortFunc(exprs, func(a, b Expr) int {
+		ta, tb := resolvedToken(a), resolvedToken(b)
+		return cmp.Or(
+			cmp.Compare(ta.Line, tb.Line),
+			strings.Compare(ta.Lexeme, tb.Lexeme),
+			strings.Compare(a.String(), b.String()),
+		)
+	})
+
+	for _, expr := range exprs {
+		fmt.Printf("[line %d] %s -> %d\n", resolvedToken(expr).Line, expr, lox.locals[expr])
+	}
+}
+
+// Every file run by the same interpreter shares the globals of the first
 func (lox *Interpreter) Evaluate() {
-	lox.globals = *NewEnvironment(nil)
-	lox.env = &lox.globals
+	if lox.env == nil {
+		lox.defineGlobals()
+	}
 
 	// Maybe can check for errors here
+	lox.run()
+}
+
+// Has to be done before running anything, since variables are looked up
+// starting from the current environment
+func (lox *Interpreter) defineGlobals() {
+	lox.globals = *lox.newEnvironment(nil)
+	lox.env = &lox.globals
+	lox.defineNatives()
+	lox.importing = make(map[string]bool)
+	lox.imported = make(map[string]bool)
+}
+
+// Runs the file in the globals, marking it as running so importing it from
+// itself (or from a file it imports) is caught
+func (lox *Interpreter) run() {
+	env := lox.env
+	lox.env = &lox.globals
+	lox.importing[lox.file] = true
 	lox.ast.Run(lox)
+	delete(lox.importing, lox.file)
+	lox.imported[lox.file] = true
+	lox.env = env
+}
+
+// Imports are run once, the first time they are reached, with the same
+// globals and resolver as the importing file
+func (lox *Interpreter) Import(id *ImportDecl) {
+	file := id.file
+	if lox.imported[file] {
+		return
+	}
+	if lox.importing[file] {
+		runtimeErrorAt(id.path.Line, fmt.Sprintf("Cyclic import of '%s'.", id.path.Literal))
+	}
+	if _, err := os.Stat(file); err != nil {
+		runtimeErrorAt(id.path.Line, fmt.Sprintf("Can't import '%s'.", id.path.Literal))
+	}
+
+	// Put back the importing file once the import is done
+	tokens, ast, importer, importerName := lox.tokens, lox.ast, lox.file, currentFile
+	currentFile = file
+
+	lexicalError := lox.Scan(file)
+	lox.Parse()
+	if lox.resolver != nil {
+		lox.Resolve()
+	}
+	if lexicalError {
+		exitWithError(65)
+	}
+	lox.run()
+
+	lox.tokens, lox.ast, lox.file, currentFile = tokens, ast, importer, importerName
+}
+
+// The timer only sets a flag, which loops and calls check, so the program
+// stops between statements instead of in the middle of printing
+func (lox *Interpreter) LimitTime(limit time.Duration) {
+	lox.outOfTime = &atomic.Bool{}
+	time.AfterFunc(limit, func() { lox.outOfTime.Store(true) })
+}
+
+func (lox *Interpreter) checkTime() {
+	if lox.outOfTime != nil && lox.outOfTime.Load() {
+		runtimeError("Execution exceeded time limit.")
+	}
+}
+
+func (lox *Interpreter) Seed(seed int64) {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	lox.random = rand.New(rand.NewSource(seed))
+}
+
+func (lox *Interpreter) PrintStats() {
+	fmt.Fprintf(os.Stderr, "tokens:       %d\n", lox.stats.tokens)
+	fmt.Fprintf(os.Stderr, "environments: %d (%d allocated)\n", lox.stats.environments, lox.stats.allocated)
+	fmt.Fprintf(os.Stderr, "calls:        %d\n", lox.stats.calls)
 }
 
 func (lox *Interpreter) NewScope() {
-	lox.env = NewEnvironment(lox.env)
+	lox.env = lox.newEnvironment(lox.env)
 }
 
 func (lox *Interpreter) EndScope() {
-	lox.env = lox.env.parent
+	env := lox.env
+	lox.env = env.parent
+	lox.releaseEnvironment(env)
 }
 
 func (lox Interpreter) GetAt(distance int, name string) Object {
-	return lox.env.Ancestor(distance).values[name]
+	return lox.ancestorWith(distance, name).values[name]
 }
 
 func (lox *Interpreter) AssignAt(distance int, name string, obj Object) {
-	lox.env.Ancestor(distance).values[name] = obj
+	lox.ancestorWith(distance, name).values[name] = obj
 }
 
-func (lox *Interpreter) LookUpVariable(expr Expr, name string) Object {
+// If the resolver got the distance wrong, say so instead of a nil map panic
+func (lox Interpreter) ancestorWith(distance int, name string) *Environment {
+	env := lox.env.Ancestor(distance)
+	if env == nil {
+		runtimeError(fmt.Sprintf("Resolver/runtime mismatch for '%s' at distance %d.", name, distance))
+	} else if _, ok := env.values[name]; !ok {
+		runtimeError(fmt.Sprintf("Resolver/runtime mismatch for '%s' at distance %d.", name, distance))
+	}
+	return env
+}
+
+// Without a resolve pass (-no-resolve), every variable is looked up by walking
+// the environments
+func (lox *Interpreter) LookUpVariable(expr Expr, name Token) Object {
 	distance, isLocal := lox.locals[expr]
 
 	if isLocal {
-		return lox.GetAt(distance, name)
-	} else {
+		return lox.GetAt(distance, name.Lexeme)
+	}
+
+	if lox.globalRefs[expr] {
 		return lox.globals.Get(name)
 	}
+	// The resolver never saw it, so walking the environments is the best guess
+	return lox.env.Get(name)
 }
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Calls reuse environments from the pool, so few are allocated however deep
+// the recursion goes
+func BenchmarkFib(b *testing.B) {
+	dir := b.TempDir()
+	path := filepath.Join(dir, "fib.lox")
+	source := `
+fun fib(n) {
+  if (n < 2) return n;
+  return fib(n - 2) + fib(n - 1);
+}
+
+fib(20);
+`
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+
+	var stats Stats
+	for range b.N {
+		lox := Interpreter{maxDepth: 1000}
+		lox.Seed(1)
+		lox.Scan(path)
+		lox.Parse()
+		lox.Resolve()
+		lox.Evaluate()
+		stats = lox.stats
+	}
+	b.ReportMetric(float64(stats.environments), "envs/op")
+	b.ReportMetric(float64(stats.allocated), "allocated-envs/op")
+}
@@ -0,0 +1,138 @@
+package main
+
+import "encoding/json"
+
+// Every node is an object with a "type" naming the node, and its children as
+// the other fields, so tools can walk the tree without a Lox parser of their own
+type node map[string]any
+
+func marshalNode(typ string, fields node) ([]byte, error) {
+	fields["type"] = typ
+	return json.Marshal(fields)
+}
+
+func (p *Program) MarshalJSON() ([]byte, error) {
+	return marshalNode("Program", node{"decls": p.decls})
+}
+
+func (cd *ClassDecl) MarshalJSON() ([]byte, error) {
+	return marshalNode("ClassDecl", node{
+		"name":       cd.name,
+		"superclass": cd.superclass,
+		"fields":     cd.fields,
+		"methods":    cd.methods,
+	})
+}
+
+func (fd *FunDecl) MarshalJSON() ([]byte, error) {
+	return marshalNode("FunDecl", node{
+		"name":     fd.name,
+		"params":   fd.params,
+		"variadic": fd.variadic,
+		"body":     fd.body,
+	})
+}
+
+func (vd *VarDecl) MarshalJSON() ([]byte, error) {
+	return marshalNode("VarDecl", node{"name": vd.name, "expr": vd.expr, "const": vd.isConst})
+}
+
+func (id *ImportDecl) MarshalJSON() ([]byte, error) {
+	return marshalNode("ImportDecl", node{"path": id.path})
+}
+
+func (es *ExprStmt) MarshalJSON() ([]byte, error) {
+	return marshalNode("ExprStmt", node{"expr": es.expr})
+}
+
+func (es *EmptyStmt) MarshalJSON() ([]byte, error) {
+	return marshalNode("EmptyStmt", node{})
+}
+
+func (is *IfStmt) MarshalJSON() ([]byte, error) {
+	return marshalNode("IfStmt", node{
+		"condition":  is.condition,
+		"thenBranch": is.thenBranch,
+		"elseBranch": is.elseBranch,
+	})
+}
+
+func (ps *PrintStmt) MarshalJSON() ([]byte, error) {
+	return marshalNode("PrintStmt", node{"exprs": ps.exprs})
+}
+
+func (rs *ReturnStmt) MarshalJSON() ([]byte, error) {
+	return marshalNode("ReturnStmt", node{"keyword": rs.keyword, "expr": rs.expr})
+}
+
+func (ws *WhileStmt) MarshalJSON() ([]byte, error) {
+	return marshalNode("WhileStmt", node{"condition": ws.condition, "body": ws.body})
+}
+
+func (fs *ForEachStmt) MarshalJSON() ([]byte, error) {
+	return marshalNode("ForEachStmt", node{"name": fs.name, "iterable": fs.iterable, "body": fs.body})
+}
+
+func (b *Block) MarshalJSON() ([]byte, error) {
+	return marshalNode("Block", node{"decls": b.decls})
+}
+
+func (ce *CommaExpr) MarshalJSON() ([]byte, error) {
+	return marshalNode("CommaExpr", node{"exprs": ce.exprs})
+}
+
+func (ae *AssignmentExpr) MarshalJSON() ([]byte, error) {
+	return marshalNode("AssignmentExpr", node{"name": ae.name, "expr": ae.expr})
+}
+
+func (se *SetExpr) MarshalJSON() ([]byte, error) {
+	return marshalNode("SetExpr", node{"object": se.object, "name": se.name, "value": se.value})
+}
+
+func (te *ThisExpr) MarshalJSON() ([]byte, error) {
+	return marshalNode("ThisExpr", node{"keyword": te.keyword})
+}
+
+func (loe *LogicOrExpr) MarshalJSON() ([]byte, error) {
+	return marshalNode("LogicOrExpr", node{"left": loe.left, "op": loe.op, "right": loe.right})
+}
+
+func (lae *LogicAndExpr) MarshalJSON() ([]byte, error) {
+	return marshalNode("LogicAndExpr", node{"left": lae.left, "op": lae.op, "right": lae.right})
+}
+
+func (be *BinaryExpr) MarshalJSON() ([]byte, error) {
+	return marshalNode("BinaryExpr", node{"left": be.left, "op": be.op, "right": be.right})
+}
+
+func (ue *UnaryExpr) MarshalJSON() ([]byte, error) {
+	return marshalNode("UnaryExpr", node{"op": ue.op, "right": ue.right})
+}
+
+func (ce *CallExpr) MarshalJSON() ([]byte, error) {
+	return marshalNode("CallExpr", node{"callee": ce.callee, "paren": ce.paren, "args": ce.args})
+}
+
+func (ge *GetExpr) MarshalJSON() ([]byte, error) {
+	return marshalNode("GetExpr", node{"object": ge.object, "name": ge.name})
+}
+
+func (le *LiteralExpr) MarshalJSON() ([]byte, error) {
+	return marshalNode("LiteralExpr", node{"token": le.token, "value": le.value})
+}
+
+func (ge *GroupExpr) MarshalJSON() ([]byte, error) {
+	return marshalNode("GroupExpr", node{"group": ge.group})
+}
+
+func (ve *VariableExpr) MarshalJSON() ([]byte, error) {
+	return marshalNode("VariableExpr", node{"name": ve.name})
+}
+
+func (se *SuperExpr) MarshalJSON() ([]byte, error) {
+	return marshalNode("SuperExpr", node{"keyword": se.keyword, "method": se.method})
+}
+
+func (oe *ObjectExpr) MarshalJSON() ([]byte, error) {
+	return marshalNode("ObjectExpr", node{"fields": oe.fields})
+}
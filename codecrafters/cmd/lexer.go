@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"strconv"
 	"strings"
@@ -13,6 +15,7 @@ type Scanner struct {
 	idx          int  //current spot in the source
 	ch           byte //current character in the source
 	lexicalError bool
+	interned     map[string]string //so every copy of a lexeme shares one string
 }
 
 func (s *Scanner) init(filename string) {
@@ -21,9 +24,14 @@ func (s *Scanner) init(filename string) {
 		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
 		os.Exit(1)
 	}
+	s.load(contents)
+}
 
+// Starts scanning source that is already in memory
+func (s *Scanner) load(contents []byte) {
 	s.line = 1
 	s.contents = contents
+	s.interned = make(map[string]string)
 	s.idx = -1
 	s.ch = 0
 	s.lexicalError = false
@@ -57,6 +65,14 @@ func (s *Scanner) peekTwo() byte {
 	return s.contents[s.idx+2]
 }
 
+func (s *Scanner) peekThree() byte {
+	if s.idx+3 >= len(s.contents) {
+		return 0
+	}
+
+	return s.contents[s.idx+3]
+}
+
 func (s *Scanner) comment() {
 	for {
 		if !s.next() || s.ch == '\n' {
@@ -68,41 +84,132 @@ func (s *Scanner) comment() {
 
 func (s *Scanner) stringLiteral() (string, bool) {
 	start := s.idx
+	startLine := s.line
 
 	for {
 		if !s.next() {
-			fmt.Fprintf(os.Stderr, "[line %d] Error: Unterminated string.", s.line)
+			fmt.Fprintf(os.Stderr, "[line %d] Error: Unterminated string.", startLine)
 			s.lexicalError = true
 			return "", false
 		} else if s.ch == '"' {
 			break
+		} else if s.ch == '\n' {
+			s.line += 1
 		}
 	}
 
-	return string(s.contents[start : s.idx+1]), true
+	return s.intern(s.contents[start : s.idx+1]), true
 }
 
-func (s *Scanner) numberLiteral() (string, string) {
+// Returns false if the number is malformed, after reporting the error
+func (s *Scanner) numberLiteral() (string, string, bool) {
 	start := s.idx
 
-	for isDigit(s.peek()) {
+	if s.ch == '0' {
+		switch s.peek() {
+		case 'x', 'X':
+			return s.integerLiteral(16, isHexDigit)
+		case 'b', 'B':
+			return s.integerLiteral(2, isBinaryDigit)
+		}
+	}
+
+	for isDigit(s.peek()) || s.peek() == '_' {
 		s.next()
 	}
-	if s.peek() == '.' && isDigit(s.peekTwo()) {
+	// The '_' is taken so 1._0 is an error, instead of a property access
+	if s.peek() == '.' && (isDigit(s.peekTwo()) || s.peekTwo() == '_') {
 		s.next()
 	}
-	for isDigit(s.peek()) {
+	for isDigit(s.peek()) || s.peek() == '_' {
 		s.next()
 	}
 
+	// An exponent needs digits, otherwise the 'e' is left for an identifier
+	if s.peek() == 'e' || s.peek() == 'E' {
+		sign := s.peekTwo() == '+' || s.peekTwo() == '-'
+		if isDigit(s.peekTwo()) || (sign && isDigit(s.peekThree())) {
+			s.next()
+			if sign {
+				s.next()
+			}
+			for isDigit(s.peek()) || s.peek() == '_' {
+				s.next()
+			}
+		}
+	}
+
 	lexeme := string(s.contents[start : s.idx+1])
-	f, _ := strconv.ParseFloat(lexeme, 64)
-	literal := fmt.Sprintf("%g", f)
+	if !s.validSeparators(lexeme, isDigit) {
+		return "", "", false
+	}
+	// Like clox's strtod, a number too big is infinity and one too small is 0
+	f, err := strconv.ParseFloat(strings.ReplaceAll(lexeme, "_", ""), 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		fmt.Fprintf(os.Stderr, "[line %d] Error: Invalid number: %s\n", s.line, lexeme)
+		s.lexicalError = true
+		return "", "", false
+	}
+
+	return lexeme, formatNumber(f), true
+}
+
+// Hexadecimal (0x1F) and binary (0b1010) literals. The literal is still the
+// decimal value, since every number is a float.
+func (s *Scanner) integerLiteral(base int, isBaseDigit func(byte) bool) (string, string, bool) {
+	start := s.idx
+	s.next() // the 'x' or 'b'
+
+	for isBaseDigit(s.peek()) || s.peek() == '_' {
+		s.next()
+	}
+
+	lexeme := string(s.contents[start : s.idx+1])
+	if !s.validSeparators(lexeme, isBaseDigit) {
+		return "", "", false
+	}
+	digits := strings.ReplaceAll(lexeme[2:], "_", "")
+	if digits == "" {
+		fmt.Fprintf(os.Stderr, "[line %d] Error: Expected digits after '%s'.\n", s.line, lexeme)
+		s.lexicalError = true
+		return "", "", false
+	}
+
+	n, err := strconv.ParseUint(digits, base, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[line %d] Error: Number literal too large: %s\n", s.line, lexeme)
+		s.lexicalError = true
+		return "", "", false
+	}
+
+	return lexeme, formatNumber(float64(n)), true
+}
+
+// A '_' can only separate two digits, e.g. 1_000 but not 1_, 1__0, or 1_.0
+func (s *Scanner) validSeparators(lexeme string, isBaseDigit func(byte) bool) bool {
+	for i := range len(lexeme) {
+		if lexeme[i] != '_' {
+			continue
+		}
+		if i == 0 || i == len(lexeme)-1 || !isBaseDigit(lexeme[i-1]) || !isBaseDigit(lexeme[i+1]) {
+			fmt.Fprintf(os.Stderr, "[line %d] Error: Invalid digit separator in number: %s\n", s.line, lexeme)
+			s.lexicalError = true
+			return false
+		}
+	}
+	return true
+}
+
+// Not %g, since that would switch to an exponent for large numbers
+func formatNumber(f float64) string {
+	if math.IsInf(f, 1) {
+		return "inf"
+	}
+	literal := strconv.FormatFloat(f, 'f', -1, 64)
 	if !strings.Contains(literal, ".") {
 		literal += ".0"
 	}
-
-	return lexeme, literal
+	return literal
 }
 
 func (s *Scanner) identifier() string {
@@ -112,7 +219,18 @@ func (s *Scanner) identifier() string {
 		s.next()
 	}
 
-	return string(s.contents[start : s.idx+1])
+	return s.intern(s.contents[start : s.idx+1])
+}
+
+// Looking up a []byte converted to a string doesn't allocate, so only the
+// first time a lexeme is seen does
+func (s *Scanner) intern(lexeme []byte) string {
+	if str, ok := s.interned[string(lexeme)]; ok {
+		return str
+	}
+	str := string(lexeme)
+	s.interned[str] = str
+	return str
 }
 
 func (s *Scanner) scan() []Token {
@@ -125,58 +243,64 @@ func (s *Scanner) scan() []Token {
 		case '\n':
 			s.line += 1
 		case '(':
-			toks = append(toks, Token{Type: LEFT_PAREN, Lexeme: string(s.ch), Line: s.line})
+			toks = append(toks, Token{Type: LEFT_PAREN, Lexeme: charLexemes[s.ch], Line: s.line})
 		case ')':
-			toks = append(toks, Token{Type: RIGHT_PAREN, Lexeme: string(s.ch), Line: s.line})
+			toks = append(toks, Token{Type: RIGHT_PAREN, Lexeme: charLexemes[s.ch], Line: s.line})
 		case '{':
-			toks = append(toks, Token{Type: LEFT_BRACE, Lexeme: string(s.ch), Line: s.line})
+			toks = append(toks, Token{Type: LEFT_BRACE, Lexeme: charLexemes[s.ch], Line: s.line})
 		case '}':
-			toks = append(toks, Token{Type: RIGHT_BRACE, Lexeme: string(s.ch), Line: s.line})
+			toks = append(toks, Token{Type: RIGHT_BRACE, Lexeme: charLexemes[s.ch], Line: s.line})
 		case ',':
-			toks = append(toks, Token{Type: COMMA, Lexeme: string(s.ch), Line: s.line})
+			toks = append(toks, Token{Type: COMMA, Lexeme: charLexemes[s.ch], Line: s.line})
 		case '.':
-			toks = append(toks, Token{Type: DOT, Lexeme: string(s.ch), Line: s.line})
+			if s.peek() == '.' && s.peekTwo() == '.' {
+				s.next()
+				s.next()
+				toks = append(toks, Token{Type: ELLIPSIS, Lexeme: "...", Line: s.line})
+			} else {
+				toks = append(toks, Token{Type: DOT, Lexeme: charLexemes[s.ch], Line: s.line})
+			}
 		case '-':
-			toks = append(toks, Token{Type: MINUS, Lexeme: string(s.ch), Line: s.line})
+			toks = append(toks, Token{Type: MINUS, Lexeme: charLexemes[s.ch], Line: s.line})
 		case '+':
-			toks = append(toks, Token{Type: PLUS, Lexeme: string(s.ch), Line: s.line})
+			toks = append(toks, Token{Type: PLUS, Lexeme: charLexemes[s.ch], Line: s.line})
 		case ';':
-			toks = append(toks, Token{Type: SEMICOLON, Lexeme: string(s.ch), Line: s.line})
+			toks = append(toks, Token{Type: SEMICOLON, Lexeme: charLexemes[s.ch], Line: s.line})
 		case '*':
-			toks = append(toks, Token{Type: STAR, Lexeme: string(s.ch), Line: s.line})
+			toks = append(toks, Token{Type: STAR, Lexeme: charLexemes[s.ch], Line: s.line})
 		case '/':
 			if s.peek() == '/' {
 				s.comment()
 			} else {
-				toks = append(toks, Token{Type: SLASH, Lexeme: string(s.ch), Line: s.line})
+				toks = append(toks, Token{Type: SLASH, Lexeme: charLexemes[s.ch], Line: s.line})
 			}
 		case '=':
 			if s.peek() == '=' {
 				s.next()
 				toks = append(toks, Token{Type: EQUAL_EQUAL, Lexeme: "==", Line: s.line})
 			} else {
-				toks = append(toks, Token{Type: EQUAL, Lexeme: string(s.ch), Line: s.line})
+				toks = append(toks, Token{Type: EQUAL, Lexeme: charLexemes[s.ch], Line: s.line})
 			}
 		case '!':
 			if s.peek() == '=' {
 				s.next()
 				toks = append(toks, Token{Type: BANG_EQUAL, Lexeme: "!=", Line: s.line})
 			} else {
-				toks = append(toks, Token{Type: BANG, Lexeme: string(s.ch), Line: s.line})
+				toks = append(toks, Token{Type: BANG, Lexeme: charLexemes[s.ch], Line: s.line})
 			}
 		case '<':
 			if s.peek() == '=' {
 				s.next()
 				toks = append(toks, Token{Type: LESS_EQUAL, Lexeme: "<=", Line: s.line})
 			} else {
-				toks = append(toks, Token{Type: LESS, Lexeme: string(s.ch), Line: s.line})
+				toks = append(toks, Token{Type: LESS, Lexeme: charLexemes[s.ch], Line: s.line})
 			}
 		case '>':
 			if s.peek() == '=' {
 				s.next()
 				toks = append(toks, Token{Type: GREATER_EQUAL, Lexeme: ">=", Line: s.line})
 			} else {
-				toks = append(toks, Token{Type: GREATER, Lexeme: string(s.ch), Line: s.line})
+				toks = append(toks, Token{Type: GREATER, Lexeme: charLexemes[s.ch], Line: s.line})
 			}
 		case '"':
 			str, found := s.stringLiteral()
@@ -185,8 +309,10 @@ func (s *Scanner) scan() []Token {
 			}
 		default:
 			if isDigit(s.ch) {
-				lexeme, literal := s.numberLiteral()
-				toks = append(toks, Token{Type: NUMBER, Lexeme: lexeme, Literal: literal, Line: s.line})
+				lexeme, literal, ok := s.numberLiteral()
+				if ok {
+					toks = append(toks, Token{Type: NUMBER, Lexeme: lexeme, Literal: literal, Line: s.line})
+				}
 			} else if isAlpha(s.ch) {
 				ident := s.identifier()
 				if r, found := reserved[ident]; found {
@@ -205,10 +331,28 @@ func (s *Scanner) scan() []Token {
 	return toks
 }
 
+// Single character lexemes share these strings, instead of converting the
+// character every time
+var charLexemes [256]string
+
+func init() {
+	for c := range charLexemes {
+		charLexemes[c] = string(rune(c))
+	}
+}
+
 func isDigit(c byte) bool {
 	return c >= '0' && c <= '9'
 }
 
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isBinaryDigit(c byte) bool {
+	return c == '0' || c == '1'
+}
+
 func isAlpha(c byte) bool {
 	return (c >= 'a' && c <= 'z') ||
 		(c >= 'A' && c <= 'z') ||
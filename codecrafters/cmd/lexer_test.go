@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The benchmark programs together, as a sizeable source with every kind of token
+func benchmarkSource(b *testing.B) []byte {
+	files, err := filepath.Glob("../../test/cases/benchmark/*.lox")
+	if err != nil || len(files) == 0 {
+		b.Skip("no benchmark programs to scan")
+	}
+
+	var source []byte
+	for _, file := range files {
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+		source = append(source, contents...)
+	}
+	return source
+}
+
+func BenchmarkScan(b *testing.B) {
+	source := benchmarkSource(b)
+	b.SetBytes(int64(len(source)))
+	b.ReportAllocs()
+
+	for range b.N {
+		scanner := Scanner{}
+		scanner.load(source)
+		scanner.scan()
+	}
+}
+
+var lexemeSink string
+
+// Interning compared to copying every lexeme into its own string, which is what
+// the scanner did before. Only the first of each lexeme allocates when interned.
+func BenchmarkIntern(b *testing.B) {
+	source := benchmarkSource(b)
+	scanner := Scanner{}
+	scanner.load(source)
+
+	// Identifiers, keywords and strings are what's interned
+	var lexemes [][]byte
+	for _, token := range scanner.scan() {
+		if token.Lexeme != "" && (isAlpha(token.Lexeme[0]) || token.Lexeme[0] == '"') {
+			lexemes = append(lexemes, []byte(token.Lexeme))
+		}
+	}
+
+	b.Run("interned", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			scanner.interned = make(map[string]string)
+			for _, lexeme := range lexemes {
+				lexemeSink = scanner.intern(lexeme)
+			}
+		}
+	})
+	b.Run("copied", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			for _, lexeme := range lexemes {
+				lexemeSink = string(lexeme)
+			}
+		}
+	})
+}
@@ -1,20 +1,42 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
 )
 
+var (
+	commaOperator = flag.Bool("comma", false, "Enable the C-style comma operator, which clox doesn't have.")
+	strictScopes  = flag.Bool("strict-scopes", false, "Using a local before its declaration in the same scope is an error.")
+	coerce        = flag.Bool("coerce", false, "Adding a string and another value stringifies the value and concatenates.")
+	maxTime       = flag.Duration("max-time", 0, "Stop a program that runs longer than this, e.g. 5s. 0 means no limit.")
+	printStats    = flag.Bool("stats", false, "Print counts of tokens, environments, and calls to stderr after a run.")
+	noResolve     = flag.Bool("no-resolve", false, "Skip resolving variables, and look them up by walking the environments.")
+	maxDepth      = flag.Int("max-depth", 1000, "How many calls deep a program can go before a stack overflow.")
+	warnings      = flag.Bool("warnings", false, "Warn about likely bugs the resolver can see, like dividing by a literal 0.")
+	seed          = flag.Int64("seed", 0, "Seed random and randomInt, so a program gives the same numbers every run. 0 seeds from the time.")
+)
+
 func main() {
-	if len(os.Args) < 3 {
-		fmt.Fprintln(os.Stderr, "Usage: ./your_program.sh [tokenize | parse | evaluate | run] <filename>")
+	flag.Parse()
+	if flag.NArg() < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: ./your_program.sh [flags] [tokenize | tokenize-json | parse | parse-json | resolve | evaluate | run] <filename>...")
 		os.Exit(1)
 	}
 
-	command := os.Args[1]
-	filename := os.Args[2]
+	command := flag.Arg(0)
+	filename := flag.Arg(1)
 
-	lox := Interpreter{}
+	lox := Interpreter{
+		commaOperator: *commaOperator,
+		strictScopes:  *strictScopes,
+		warnings:      *warnings,
+		coerce:        *coerce,
+		maxDepth:      *maxDepth,
+	}
+	lox.Seed(*seed)
 	lexicalError := lox.Scan(filename)
 
 	switch command {
@@ -23,27 +45,70 @@ func main() {
 			fmt.Println(token.String())
 		}
 
+	case "tokenize-json":
+		out, err := json.MarshalIndent(lox.tokens, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding tokens: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(out))
+
 	case "parse":
 		lox.Parse()
 		fmt.Println(lox.ast.String())
 
+	case "parse-json":
+		lox.Parse()
+		out, err := json.MarshalIndent(&lox.ast, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding the syntax tree: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(out))
+
 	case "evaluate":
 		// Evaluate is a special case, since it only parses expressions
 		parser := Parser{}
 		parser.tokens = lox.tokens
+		parser.commaOperator = lox.commaOperator
 		ast := parser.expression()
+		lox.defineGlobals()
 		res := ast.Evaluate(&lox)
-		// This check might be old, now that I'm using Objects
-		if res == nil {
-			fmt.Println("nil")
-		} else {
-			fmt.Println(res)
-		}
+		fmt.Println(stringify(res))
 
-	case "run":
+	case "resolve":
 		lox.Parse()
 		lox.Resolve()
-		lox.Evaluate()
+		lox.PrintLocals()
+
+	case "run":
+		// Files are run in order, so later files can use what earlier ones declare
+		files := flag.Args()[1:]
+		if *maxTime > 0 {
+			lox.LimitTime(*maxTime)
+		}
+		for i, file := range files {
+			if len(files) > 1 {
+				currentFile = file
+			}
+			if i > 0 {
+				lexicalError = lox.Scan(file)
+			}
+
+			lox.Parse()
+			if !*noResolve {
+				lox.Resolve()
+			}
+			lox.Evaluate()
+
+			// Stop before the next file, while it's still known which file had it
+			if lexicalError {
+				exitWithError(65)
+			}
+		}
+		if *printStats {
+			lox.PrintStats()
+		}
 
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The interpreter exits the process on errors, so tests run it as a separate
+// process: the test binary runs main instead of the tests when this is set
+const runMainEnv = "LOX_TEST_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// Runs the interpreter with the arguments, e.g. "run", "file.lox"
+func runLox(t *testing.T, stdin string, args ...string) (stdout, stderr string, code int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	cmd.Stdin = strings.NewReader(stdin)
+	var out, errOut bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errOut
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatalf("running the interpreter: %v", err)
+	}
+	return out.String(), errOut.String(), code
+}
+
+// Writes the source to a file in a temporary directory, returning its path
+func writeLox(t *testing.T, dir, name, source string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLexicalErrorNamesTheFile(t *testing.T) {
+	dir := t.TempDir()
+	good := writeLox(t, dir, "good.lox", "print \"good\";\n")
+	bad := writeLox(t, dir, "bad.lox", "print \"bad\";\n@\n")
+
+	for _, files := range [][]string{{bad, good}, {good, bad}} {
+		stdout, stderr, code := runLox(t, "", append([]string{"run"}, files...)...)
+		if code != 65 {
+			t.Errorf("run %v exited with %d, want 65", files, code)
+		}
+		if !strings.Contains(stderr, "[line 2] Error: Unexpected character: @") {
+			t.Errorf("run %v stderr = %q, want the lexical error", files, stderr)
+		}
+		if !strings.Contains(stderr, "in "+bad) {
+			t.Errorf("run %v stderr = %q, want it to name %s", files, stderr, bad)
+		}
+		if files[0] == bad && strings.Contains(stdout, "good") {
+			t.Errorf("run %v ran the file after the error, stdout = %q", files, stdout)
+		}
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		source string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{"print 1; exit(3); print 2;", 3, "1\n", ""},
+		{"exit(0); print 2;", 0, "", ""},
+		{"exit(255);", 255, "", ""},
+		{"exit(256);", 70, "", "Exit code must be between 0 and 255."},
+		{"exit(-1);", 70, "", "Exit code must be between 0 and 255."},
+		{"exit(1.5);", 70, "", "Exit code must be a whole number."},
+	}
+	for _, test := range tests {
+		path := writeLox(t, dir, "exit.lox", test.source)
+		stdout, stderr, code := runLox(t, "", "run", path)
+		if code != test.code || stdout != test.stdout || !strings.Contains(stderr, test.stderr) {
+			t.Errorf("%s: exit %d, stdout %q, stderr %q; want exit %d, stdout %q, stderr containing %q",
+				test.source, code, stdout, stderr, test.code, test.stdout, test.stderr)
+		}
+	}
+}
+
+// Only what would break the one-line format is escaped, so an ordinary string
+// with a backslash tokenizes the same as the reference
+func TestTokenizeStringEscapes(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		source string
+		token  string
+	}{
+		{`"a\b"`, `STRING "a\b" a\b`},
+		{`"a\nb"`, `STRING "a\nb" a\nb`},
+		{"\"tab\there\"", `STRING "tab\there" tab\there`},
+		{"\"two\nlines\"", `STRING "two\nlines" two\nlines`},
+	}
+	for _, test := range tests {
+		path := writeLox(t, dir, "string.lox", test.source)
+		stdout, _, _ := runLox(t, "", "tokenize", path)
+		if first := strings.Split(stdout, "\n")[0]; first != test.token {
+			t.Errorf("tokenize %q = %q, want %q", test.source, first, test.token)
+		}
+	}
+}
+
+func TestReadingStdin(t *testing.T) {
+	dir := t.TempDir()
+	path := writeLox(t, dir, "read.lox", `
+var name = input("name? ");
+print name;
+print readLine();
+print readLine();
+`)
+	tests := []struct {
+		name   string
+		stdin  string
+		stdout string
+	}{
+		{"lines", "Ada\r\nLovelace\n", "name? Ada\nLovelace\nnil\n"},
+		{"no newline at the end", "Ada\nLovelace", "name? Ada\nLovelace\nnil\n"},
+		{"empty line", "\n\n", "name? \n\nnil\n"},
+		{"empty stdin", "", "name? nil\nnil\nnil\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stdout, stderr, code := runLox(t, test.stdin, "run", path)
+			if code != 0 {
+				t.Fatalf("exit %d, stderr %q", code, stderr)
+			}
+			if stdout != test.stdout {
+				t.Errorf("stdout = %q, want %q", stdout, test.stdout)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Functions implemented in Go, which are defined as globals before a program
+// runs. They can be shadowed like any other global.
+type LoxNative struct {
+	name     string
+	arity    int
+	optional int // how many more arguments it can take after the arity
+	fn       func(lox *Interpreter, args []Object) Object
+}
+
+func (n *LoxNative) Type() ObjectType { return Function }
+func (n *LoxNative) String() string   { return "<native fn>" }
+
+func (n *LoxNative) Call(lox *Interpreter, args []Object) (ret Object) {
+	if most := n.arity + n.optional; len(args) > most {
+		runtimeError(fmt.Sprintf("Expected at most %d arguments but got %d.", most, len(args)))
+	}
+	return n.fn(lox, args)
+}
+
+func (n *LoxNative) Arity() int {
+	return n.arity
+}
+
+// Optional arguments are checked by Call, since they aren't a rest parameter
+func (n *LoxNative) Variadic() bool {
+	return n.optional > 0
+}
+
+var natives = []*LoxNative{
+	{"clock", 0, 0, nativeClock},
+	{"write", 1, 0, nativeWrite},
+	{"exit", 1, 0, nativeExit},
+	{"assert", 1, 0, nativeAssert},
+	{"assert2", 2, 0, nativeAssert2},
+	{"number", 1, 0, nativeNumber},
+	{"string", 1, 0, nativeString},
+	{"readLine", 0, 0, nativeReadLine},
+	{"input", 1, 0, nativeInput},
+	{"min", 2, 0, nativeMin},
+	{"max", 2, 0, nativeMax},
+	{"round", 1, 1, nativeRound},
+	{"random", 0, 0, nativeRandom},
+	{"randomInt", 2, 0, nativeRandomInt},
+}
+
+func (lox *Interpreter) defineNatives() {
+	for _, native := range natives {
+		lox.globals.Define(native.name, native)
+	}
+}
+
+func nativeClock(lox *Interpreter, args []Object) Object {
+	return &LoxNumber{float64(time.Now().UnixNano()) / 1e9}
+}
+
+// Like print, but without the newline
+func nativeWrite(lox *Interpreter, args []Object) Object {
+	fmt.Print(display(lox, args[0], lox.callLine))
+	return &LoxNil{}
+}
+
+// Stdout isn't buffered, so there is nothing to flush before exiting
+func nativeExit(lox *Interpreter, args []Object) Object {
+	code, ok := IsNumber(args[0])
+	if !ok || code != math.Trunc(code) {
+		runtimeError("Exit code must be a whole number.")
+	}
+	// A status is only a byte, so anything else would be cut down to one
+	if code < 0 || code > 255 {
+		runtimeError("Exit code must be between 0 and 255.")
+	}
+	os.Exit(int(code))
+	return nil
+}
+
+func nativeAssert(lox *Interpreter, args []Object) Object {
+	if !IsTruthy(args[0]) {
+		runtimeError("Assertion failed.")
+	}
+	return &LoxNil{}
+}
+
+// Lox doesn't have optional arguments, so the message is a separate native
+func nativeAssert2(lox *Interpreter, args []Object) Object {
+	if !IsTruthy(args[0]) {
+		runtimeError(stringify(args[1]))
+	}
+	return &LoxNil{}
+}
+
+// Returns nil if the value can't be parsed, so a program can check for that
+func nativeNumber(lox *Interpreter, args []Object) Object {
+	switch val := args[0].(type) {
+	case *LoxNumber:
+		return val
+	case *LoxString:
+		if f, err := strconv.ParseFloat(val.str, 64); err == nil {
+			return &LoxNumber{f}
+		}
+	}
+	return &LoxNil{}
+}
+
+// The same text print would show, including an instance's toString
+func nativeString(lox *Interpreter, args []Object) Object {
+	return &LoxString{display(lox, args[0], lox.callLine)}
+}
+
+// Shared by every native that reads, so nothing is lost in a buffer
+var stdin = bufio.NewReader(os.Stdin)
+
+// Returns the line without its newline, or nil at the end of the input
+func nativeReadLine(lox *Interpreter, args []Object) Object {
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return &LoxNil{}
+	}
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return &LoxString{line}
+}
+
+// Prompts for and reads a line
+func nativeInput(lox *Interpreter, args []Object) Object {
+	nativeWrite(lox, args)
+	return nativeReadLine(lox, []Object{})
+}
+
+func nativeMin(lox *Interpreter, args []Object) Object {
+	a, b := numberArgs("min", args)
+	return &LoxNumber{math.Min(a, b)}
+}
+
+func nativeMax(lox *Interpreter, args []Object) Object {
+	a, b := numberArgs("max", args)
+	return &LoxNumber{math.Max(a, b)}
+}
+
+func numberArgs(name string, args []Object) (float64, float64) {
+	a, aok := IsNumber(args[0])
+	b, bok := IsNumber(args[1])
+	if !aok || !bok {
+		runtimeError(fmt.Sprintf("Arguments to %s must be numbers.", name))
+	}
+	return a, b
+}
+
+// Rounds to a whole number, or to that many decimal places
+func nativeRound(lox *Interpreter, args []Object) Object {
+	x, ok := IsNumber(args[0])
+	if !ok {
+		runtimeError("Can only round a number.")
+	}
+	if len(args) == 1 {
+		return &LoxNumber{math.Round(x)}
+	}
+
+	digits, ok := IsNumber(args[1])
+	if !ok || digits != math.Trunc(digits) {
+		runtimeError("Digits to round to must be a whole number.")
+	}
+	scale := math.Pow(10, digits)
+	return &LoxNumber{math.Round(x*scale) / scale}
+}
+
+// Between 0 and 1, including 0 but never 1
+func nativeRandom(lox *Interpreter, args []Object) Object {
+	return &LoxNumber{lox.random.Float64()}
+}
+
+// A whole number from lo up to and including hi, like rolling a die
+func nativeRandomInt(lox *Interpreter, args []Object) Object {
+	lo, hi := numberArgs("randomInt", args)
+	if lo != math.Trunc(lo) || hi != math.Trunc(hi) {
+		runtimeError("Arguments to randomInt must be whole numbers.")
+	}
+	if lo > hi {
+		runtimeError("The low bound of randomInt can't be more than the high bound.")
+	}
+	// The range has to fit in the int64 the number is picked from
+	if hi-lo >= math.MaxInt64 {
+		runtimeError("The range of randomInt is too big.")
+	}
+	return &LoxNumber{lo + float64(lox.random.Int63n(int64(hi-lo)+1))}
+}
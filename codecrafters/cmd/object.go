@@ -1,6 +1,10 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+	"strings"
+)
 
 type ObjectType int
 
@@ -12,6 +16,7 @@ const (
 	Function
 	Class
 	Instance
+	List
 )
 
 type Object interface {
@@ -22,28 +27,28 @@ type Object interface {
 type LoxNil struct{}
 
 func (n *LoxNil) Type() ObjectType { return Nil }
-func (n *LoxNil) String() string   { return "nil" }
+func (n *LoxNil) String() string   { return stringify(n) }
 
 type LoxBool struct {
 	value bool
 }
 
 func (b *LoxBool) Type() ObjectType { return Bool }
-func (b *LoxBool) String() string   { return fmt.Sprintf("%t", b.value) }
+func (b *LoxBool) String() string   { return stringify(b) }
 
 type LoxNumber struct {
 	num float64
 }
 
 func (n *LoxNumber) Type() ObjectType { return Number }
-func (n *LoxNumber) String() string   { return fmt.Sprintf("%.10g", n.num) }
+func (n *LoxNumber) String() string   { return stringify(n) }
 
 type LoxString struct {
 	str string
 }
 
 func (s *LoxString) Type() ObjectType { return String }
-func (s *LoxString) String() string   { return s.str }
+func (s *LoxString) String() string   { return stringify(s) }
 
 type LoxFunction struct {
 	funDecl *FunDecl
@@ -57,20 +62,70 @@ func (f *LoxFunction) String() string   { return fmt.Sprintf("<fn %s>", f.funDec
 type LoxClass struct {
 	name       string
 	superclass *LoxClass
+	fields     []*VarDecl
 	methods    map[string]*LoxFunction
+	closure    *Environment            //where the field defaults are evaluated
+	cache      map[string]*LoxFunction //methods found by FindMethod, including inherited ones
 }
 
 func (c *LoxClass) Type() ObjectType { return Class }
 func (c *LoxClass) String() string   { return c.name }
 
 type LoxInstance struct {
-	loxClass LoxClass
+	loxClass *LoxClass
 	fields   map[string]Object
 }
 
 func (i *LoxInstance) Type() ObjectType { return Instance }
 func (i *LoxInstance) String() string   { return i.loxClass.name + " instance" }
 
+type LoxList struct {
+	elements []Object
+}
+
+func (l *LoxList) Type() ObjectType { return List }
+func (l *LoxList) String() string {
+	sb := strings.Builder{}
+	sb.WriteByte('[')
+	for i, elem := range l.elements {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(stringify(elem))
+	}
+	sb.WriteByte(']')
+	return sb.String()
+}
+
+// The one place values are formatted for printing, so the output can be kept
+// identical to clox. Objects like functions and classes format themselves.
+func stringify(obj Object) string {
+	switch val := obj.(type) {
+	case nil, *LoxNil:
+		return "nil"
+	case *LoxBool:
+		return fmt.Sprintf("%t", val.value)
+	case *LoxNumber:
+		// C's printf, which clox uses, prints these differently than Go
+		switch {
+		case math.IsInf(val.num, 1):
+			return "inf"
+		case math.IsInf(val.num, -1):
+			return "-inf"
+		case math.IsNaN(val.num):
+			return "nan"
+		case val.num == 0 && math.Signbit(val.num):
+			// The reference keeps the sign, e.g. print -0; prints -0
+			return "-0"
+		}
+		return fmt.Sprintf("%.10g", val.num)
+	case *LoxString:
+		return val.str
+	default:
+		return obj.String()
+	}
+}
+
 // Helper functions to extract objects
 func IsNumber(obj Object) (float64, bool) {
 	if n, ok := obj.(*LoxNumber); ok {
@@ -119,6 +174,13 @@ func IsInstance(obj Object) (*LoxInstance, bool) {
 	return nil, false
 }
 
+func IsList(obj Object) (*LoxList, bool) {
+	if l, ok := obj.(*LoxList); ok {
+		return l, true
+	}
+	return nil, false
+}
+
 // Only false and nil are falsy
 func IsTruthy(obj Object) bool {
 	switch val := obj.(type) {
@@ -3,12 +3,17 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"slices"
 )
 
 type Parser struct {
-	tokens []Token
-	idx    int
+	tokens   []Token
+	idx      int
+	funDepth int    // how many function bodies deep, to reject top-level returns
+	dir      string // the directory of the file, which imports are relative to
+
+	commaOperator bool
 }
 
 func (p *Parser) program() Program {
@@ -27,6 +32,10 @@ func (p *Parser) declaration() Stmt {
 		return p.funDecl()
 	case p.match(VAR):
 		return p.varDecl()
+	case p.match(CONST):
+		return p.constDecl()
+	case p.match(IMPORT):
+		return p.importDecl()
 	default:
 		return p.statement()
 	}
@@ -44,14 +53,28 @@ func (p *Parser) classDecl() Stmt {
 	}
 	p.consume(LEFT_BRACE, "Expect '{' before class body")
 
+	fields := []*VarDecl{}
 	methods := []*FunDecl{}
 	for !p.check(RIGHT_BRACE) && !p.atEnd() {
-		methods = append(methods, p.funDecl().(*FunDecl))
+		if p.check(IDENTIFIER) && p.checkNext(EQUAL) {
+			fields = append(fields, p.fieldDecl())
+		} else {
+			methods = append(methods, p.funDecl().(*FunDecl))
+		}
 	}
 
 	p.consume(RIGHT_BRACE, "Expect '}' after class body")
 
-	return &ClassDecl{name.Lexeme, superclass, methods}
+	return &ClassDecl{name.Lexeme, superclass, fields, methods}
+}
+
+// A field with a default value, like `x = 0;`
+func (p *Parser) fieldDecl() *VarDecl {
+	name := p.advance()
+	p.consume(EQUAL, "Expect '=' after field name")
+	expr := p.expression()
+	p.consume(SEMICOLON, "Expect ';' after field default")
+	return &VarDecl{name: name.Lexeme, expr: expr}
 }
 
 func (p *Parser) funDecl() Stmt {
@@ -59,20 +82,34 @@ func (p *Parser) funDecl() Stmt {
 	p.consume(LEFT_PAREN, "Expect '(' after function name")
 
 	params := []Token{}
+	variadic := false
 	if !p.check(RIGHT_PAREN) {
-		params = append(params, p.consume(IDENTIFIER, "Expect an identifier"))
-		for p.match(COMMA) {
+		for {
+			if p.match(ELLIPSIS) {
+				params = append(params, p.consume(IDENTIFIER, "Expect an identifier after '...'"))
+				variadic = true
+				if p.match(COMMA) && !p.check(RIGHT_PAREN) {
+					p.error("A rest parameter must be the last parameter")
+				}
+				break
+			}
 			params = append(params, p.consume(IDENTIFIER, "Expect an identifier"))
+			// Allows a trailing comma
+			if !p.match(COMMA) || p.check(RIGHT_PAREN) {
+				break
+			}
 		}
 	}
 
 	p.consume(RIGHT_PAREN, "Expect ')' after parameters")
 
 	p.consume(LEFT_BRACE, "Expect '{' before function body")
+	p.funDepth++
 	body := p.block().(*Block)
 	// block consumes the trailing '}'
+	p.funDepth--
 
-	return &FunDecl{name: name.Lexeme, params: params, body: body.decls}
+	return &FunDecl{name: name.Lexeme, params: params, variadic: variadic, body: body.decls}
 }
 
 func (p *Parser) varDecl() Stmt {
@@ -89,6 +126,27 @@ func (p *Parser) varDecl() Stmt {
 	return &vd
 }
 
+// Like varDecl, except an initializer is required since it can't be assigned later
+func (p *Parser) constDecl() Stmt {
+	name := p.consume(IDENTIFIER, "A const declaration must have an identifier")
+	p.consume(EQUAL, "Expected '=' after const name")
+	expr := p.expression()
+	p.match(SEMICOLON)
+
+	return &VarDecl{name: name.Lexeme, expr: expr, isConst: true}
+}
+
+func (p *Parser) importDecl() Stmt {
+	path := p.consume(STRING, "Expect a path after 'import'")
+	p.consume(SEMICOLON, "Expected ';' after import path")
+
+	file := path.Literal
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(p.dir, file)
+	}
+	return &ImportDecl{path, file}
+}
+
 func (p *Parser) statement() Stmt {
 	switch {
 	case p.match(FOR):
@@ -103,6 +161,8 @@ func (p *Parser) statement() Stmt {
 		return p.whileStmt()
 	case p.match(LEFT_BRACE):
 		return p.block()
+	case p.match(SEMICOLON):
+		return &EmptyStmt{}
 	default:
 		return p.exprStmt()
 	}
@@ -114,14 +174,23 @@ func (p *Parser) exprStmt() Stmt {
 	return &ExprStmt{expr}
 }
 
+// Commas separate the values, even with the comma operator, which needs
+// parentheses here like in arguments
 func (p *Parser) printStmt() Stmt {
-	expr := p.expression()
+	key := p.previous()
+	exprs := []Expr{p.assignment()}
+	for p.match(COMMA) {
+		exprs = append(exprs, p.assignment())
+	}
 	p.match(SEMICOLON)
-	return &PrintStmt{expr}
+	return &PrintStmt{key, exprs}
 }
 
 func (p *Parser) returnStmt() Stmt {
 	key := p.previous()
+	if p.funDepth == 0 {
+		p.errorAt(key, "Cannot return from top-level code.")
+	}
 	if p.match(SEMICOLON) {
 		return &ReturnStmt{key, nil}
 	} else {
@@ -154,6 +223,11 @@ func (p *Parser) whileStmt() Stmt {
 func (p *Parser) forStmt() Stmt {
 	p.consume(LEFT_PAREN, "Expected '(' after 'for'")
 
+	// "in" isn't reserved, so it can still be used as a name elsewhere
+	if p.check(IDENTIFIER) && p.checkNext(IDENTIFIER) && p.tokens[p.idx+1].Lexeme == "in" {
+		return p.forEachStmt()
+	}
+
 	// Initializer
 	var initializer Stmt
 	switch {
@@ -185,11 +259,23 @@ func (p *Parser) forStmt() Stmt {
 	return forToWhile(initializer, condition, increment, body)
 }
 
+func (p *Parser) forEachStmt() Stmt {
+	name := p.advance()
+	p.advance() // in
+	iterable := p.expression()
+	p.consume(RIGHT_PAREN, "Expected ')' after the list to loop over")
+	body := p.statement()
+	return &ForEachStmt{name, iterable, body}
+}
+
 // Desugars a for loop into a while loop.
 func forToWhile(initializer Stmt, condition Expr, increment Expr, body Stmt) Stmt {
 	// Add the increment first, since it is in the inner block
 	whileBody := body
-	if increment != nil {
+	if _, empty := body.(*EmptyStmt); empty && increment != nil {
+		// No need for a block when the increment is the only thing to run
+		whileBody = &ExprStmt{increment}
+	} else if increment != nil {
 		whileBody = &Block{decls: []Stmt{body, &ExprStmt{increment}}}
 	}
 
@@ -208,22 +294,46 @@ func forToWhile(initializer Stmt, condition Expr, increment Expr, body Stmt) Stm
 	return whileComplex
 }
 
+// Expects the '{' to have already been consumed
 func (p *Parser) block() Stmt {
+	open := p.previous()
 	stmts := []Stmt{}
 
 	for !p.check(RIGHT_BRACE) && !p.atEnd() {
 		stmts = append(stmts, p.declaration())
 	}
 
-	p.consume(RIGHT_BRACE, "Expected '}' after block")
+	// Point back to the opening brace, since EOF could be far away from it
+	if !p.check(RIGHT_BRACE) {
+		p.error(fmt.Sprintf("Expected '}' to close block opened at line %d", open.Line))
+	}
+	p.advance()
 
 	return &Block{decls: stmts}
 }
 
 func (p *Parser) expression() Expr {
+	if p.commaOperator {
+		return p.comma()
+	}
 	return p.assignment()
 }
 
+// Has the lowest precedence. Anywhere a comma is already a separator, like
+// arguments, has to skip this level by calling assignment directly.
+func (p *Parser) comma() Expr {
+	expr := p.assignment()
+	if !p.check(COMMA) {
+		return expr
+	}
+
+	exprs := []Expr{expr}
+	for p.match(COMMA) {
+		exprs = append(exprs, p.assignment())
+	}
+	return &CommaExpr{exprs}
+}
+
 // This function is a little weird. Go read the book: 8.4.1
 func (p *Parser) assignment() Expr {
 	expr := p.logicOr()
@@ -233,7 +343,7 @@ func (p *Parser) assignment() Expr {
 		value := p.assignment() // ugh it's recursive
 
 		if ve, ok := expr.(*VariableExpr); ok {
-			return &AssignmentExpr{name: ve.name.Lexeme, expr: value}
+			return &AssignmentExpr{name: ve.name, expr: value}
 		}
 		if ge, ok := expr.(*GetExpr); ok {
 			return &SetExpr{object: ge.object, name: ge.name.Lexeme, value: value}
@@ -367,15 +477,16 @@ func (p *Parser) arguments(callee Expr) Expr {
 	args := []Expr{}
 
 	if !p.check(RIGHT_PAREN) {
-		args = append(args, p.expression())
-		for p.match(COMMA) {
-			args = append(args, p.expression())
+		args = append(args, p.assignment())
+		// Allows a trailing comma
+		for p.match(COMMA) && !p.check(RIGHT_PAREN) {
+			args = append(args, p.assignment())
 		}
 	}
 
-	p.consume(RIGHT_PAREN, "Expected ')' after arguments")
+	paren := p.consume(RIGHT_PAREN, "Expected ')' after arguments")
 
-	return &CallExpr{callee: callee, args: args}
+	return &CallExpr{callee: callee, paren: paren, args: args}
 }
 
 func (p *Parser) primary() Expr {
@@ -406,6 +517,8 @@ func (p *Parser) primary() Expr {
 		p.consume(DOT, "Expect '.' after 'super'.")
 		method := p.consume(IDENTIFIER, "Expect superclass method name.")
 		return &SuperExpr{keyword, method}
+	case p.match(OBJECT):
+		return p.objectLiteral()
 	default:
 		p.error("Expected an expression")
 	}
@@ -414,6 +527,21 @@ func (p *Parser) primary() Expr {
 	return expr
 }
 
+func (p *Parser) objectLiteral() Expr {
+	p.consume(LEFT_BRACE, "Expect '{' after 'object'")
+
+	fields := []*VarDecl{}
+	for !p.check(RIGHT_BRACE) && !p.atEnd() {
+		if !p.check(IDENTIFIER) {
+			p.error("Expect a field name")
+		}
+		fields = append(fields, p.fieldDecl())
+	}
+
+	p.consume(RIGHT_BRACE, "Expect '}' after object fields")
+	return &ObjectExpr{fields}
+}
+
 // --------------- Helper Functions --------------- //
 
 // Check if any of the types match the current token type, advances if true.
@@ -439,6 +567,10 @@ func (p *Parser) check(typ TokenType) bool {
 	return !p.atEnd() && p.current().Type == typ
 }
 
+func (p *Parser) checkNext(typ TokenType) bool {
+	return p.idx+1 < len(p.tokens) && p.tokens[p.idx+1].Type == typ
+}
+
 func (p *Parser) advance() Token {
 	tok := p.current()
 	if !p.atEnd() {
@@ -464,7 +596,10 @@ func (p *Parser) previous() Token {
 }
 
 func (p *Parser) error(msg string) {
-	tok := p.tokens[p.idx]
+	p.errorAt(p.tokens[p.idx], msg)
+}
+
+func (p *Parser) errorAt(tok Token, msg string) {
 	fmt.Fprintf(os.Stderr, "[line %d] Error at '%s': %s\n", tok.Line, tok.Lexeme, msg)
-	os.Exit(65)
+	exitWithError(65)
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
 )
 
 // In order for variables to always evaluate to the same value (in closures?),
@@ -37,22 +38,36 @@ const (
 )
 
 type Resolver struct {
-	locals    map[Expr]int
-	scopes    []map[string]bool
-	funcType  FunctionType
-	classType ClassType
+	locals     map[Expr]int
+	globalRefs map[Expr]bool // every variable not in locals, so nothing is missed
+	scopes     []map[string]bool
+	consts     []map[string]bool // names declared with const, parallel to scopes
+	later      []map[string]bool // names declared further on in the scope, parallel to scopes
+	globals    map[string]bool   // const-ness of globals, since they have no scope
+	funcType   FunctionType
+	funcScope  int // the outermost scope of the function being resolved
+	classType  ClassType
+
+	strictScopes bool // using a local before its declaration in the same scope is an error
+	warnings     bool // report likely bugs, without stopping the program
 }
 
 func NewResolver() *Resolver {
 	return &Resolver{
-		locals: make(map[Expr]int),
-		scopes: []map[string]bool{},
+		locals:     make(map[Expr]int),
+		globalRefs: make(map[Expr]bool),
+		scopes:     []map[string]bool{},
+		consts:     []map[string]bool{},
+		later:      []map[string]bool{},
+		globals:    make(map[string]bool),
 	}
 }
 
 // Helper functions for scopes
 func (r *Resolver) BeginScope() {
 	r.scopes = append(r.scopes, make(map[string]bool))
+	r.consts = append(r.consts, make(map[string]bool))
+	r.later = append(r.later, make(map[string]bool))
 }
 
 func (r *Resolver) EndScope() {
@@ -60,6 +75,8 @@ func (r *Resolver) EndScope() {
 		panic("No scope to end")
 	}
 	r.scopes = r.scopes[:len(r.scopes)-1]
+	r.consts = r.consts[:len(r.consts)-1]
+	r.later = r.later[:len(r.later)-1]
 }
 
 // Common interface for all AST nodes to implement
@@ -84,7 +101,7 @@ func (c *ClassDecl) resolve(r *Resolver) {
 		r.classType = ClassTypeSubclass
 		if c.name == c.superclass.name.Lexeme {
 			fmt.Fprintf(os.Stderr, "A class can't inherit from itself.\n")
-			os.Exit(65)
+			exitWithError(65)
 		}
 
 		c.superclass.resolve(r)
@@ -98,6 +115,10 @@ func (c *ClassDecl) resolve(r *Resolver) {
 	r.declare("this")
 	r.define("this")
 
+	for _, field := range c.fields {
+		field.expr.resolve(r)
+	}
+
 	for _, method := range c.methods {
 		fnType := FunctionTypeMethod
 		if method.name == "init" {
@@ -126,17 +147,21 @@ func (r *Resolver) resolveFunction(fd *FunDecl, funcType FunctionType) {
 	enclosingFnType := r.funcType
 	r.funcType = funcType
 
+	enclosingScope := r.funcScope
 	r.BeginScope()
+	r.funcScope = len(r.scopes) - 1
 	for _, param := range fd.params {
-		r.declare(param.Lexeme)
+		r.declareParam(param)
 		r.define(param.Lexeme)
 	}
+	r.declareLater(fd.body)
 	for _, stmt := range fd.body {
 		stmt.resolve(r)
 	}
 	r.EndScope()
 
 	r.funcType = enclosingFnType
+	r.funcScope = enclosingScope
 }
 
 func (vd *VarDecl) resolve(r *Resolver) {
@@ -145,12 +170,17 @@ func (vd *VarDecl) resolve(r *Resolver) {
 		vd.expr.resolve(r)
 	}
 	r.define(vd.name)
+	r.setConst(vd.name, vd.isConst)
 }
 
 func (es *ExprStmt) resolve(r *Resolver) {
 	es.expr.resolve(r)
 }
 
+func (es *EmptyStmt) resolve(r *Resolver) {
+	// Nothing to resolve
+}
+
 func (is *IfStmt) resolve(r *Resolver) {
 	is.condition.resolve(r)
 	if is.elseBranch != nil {
@@ -160,18 +190,22 @@ func (is *IfStmt) resolve(r *Resolver) {
 }
 
 func (ps *PrintStmt) resolve(r *Resolver) {
-	ps.expr.resolve(r)
+	for _, expr := range ps.exprs {
+		expr.resolve(r)
+	}
 }
 
 func (rs *ReturnStmt) resolve(r *Resolver) {
 	if r.funcType == FunctionTypeNone {
 		fmt.Fprintf(os.Stderr, "Cannot return from top-level code.")
-		os.Exit(65)
+		exitWithError(65)
 	}
+	// A bare return is fine, since Call returns "this" from an initializer anyway
 	if rs.expr != nil {
 		if r.funcType == FunctionTypeInitializer {
-			fmt.Fprintf(os.Stderr, "Cannot return from initializer.")
-			os.Exit(65)
+			msg := "Can't return a value from an initializer."
+			fmt.Fprintf(os.Stderr, "[line %d] Error at 'return': %s\n", rs.keyword.Line, msg)
+			exitWithError(65)
 		}
 		rs.expr.resolve(r)
 	}
@@ -182,17 +216,46 @@ func (ws *WhileStmt) resolve(r *Resolver) {
 	ws.body.resolve(r)
 }
 
+func (fs *ForEachStmt) resolve(r *Resolver) {
+	fs.iterable.resolve(r)
+
+	r.BeginScope()
+	r.declare(fs.name.Lexeme)
+	r.define(fs.name.Lexeme)
+	fs.body.resolve(r)
+	r.EndScope()
+}
+
+func (id *ImportDecl) resolve(r *Resolver) {
+	// The imported file is resolved when it is run
+}
+
 func (b *Block) resolve(r *Resolver) {
 	r.BeginScope()
+	r.declareLater(b.decls)
 	for _, decl := range b.decls {
 		decl.resolve(r)
 	}
 	r.EndScope()
 }
 
+func (ce *CommaExpr) resolve(r *Resolver) {
+	for _, expr := range ce.exprs {
+		expr.resolve(r)
+	}
+}
+
 func (ae *AssignmentExpr) resolve(r *Resolver) {
 	ae.expr.resolve(r)
-	r.resolveLocal(ae, ae.name)
+
+	if r.isConst(ae.name.Lexeme) {
+		msg := fmt.Sprintf("Cannot assign to const variable '%s'.", ae.name.Lexeme)
+		fmt.Fprintf(os.Stderr, "[line %d] Error at '%s': %s\n", ae.name.Line, ae.name.Lexeme, msg)
+		exitWithError(65)
+	}
+
+	r.checkDeclaredLater(ae.name)
+	r.resolveLocal(ae, ae.name.Lexeme)
 }
 
 func (se *SetExpr) resolve(r *Resolver) {
@@ -204,7 +267,7 @@ func (se *SetExpr) resolve(r *Resolver) {
 func (te *ThisExpr) resolve(r *Resolver) {
 	if r.classType == ClassTypeNone {
 		fmt.Fprintf(os.Stderr, "Cannot use 'this' outside of a class.")
-		os.Exit(65)
+		exitWithError(65)
 	}
 	r.resolveLocal(te, te.keyword.Lexeme)
 }
@@ -222,6 +285,15 @@ func (lae *LogicAndExpr) resolve(r *Resolver) {
 func (be *BinaryExpr) resolve(r *Resolver) {
 	be.left.resolve(r)
 	be.right.resolve(r)
+
+	// Only a literal is known now, any other divisor could be zero or not
+	if r.warnings && be.op.Type == SLASH {
+		if le, ok := be.right.(*LiteralExpr); ok && le.token.Type == NUMBER {
+			if n, _ := strconv.ParseFloat(le.token.Literal, 64); n == 0 {
+				fmt.Fprintf(os.Stderr, "[line %d] Warning at '/': Division by zero.\n", be.op.Line)
+			}
+		}
+	}
 }
 
 func (ue *UnaryExpr) resolve(r *Resolver) {
@@ -255,39 +327,93 @@ func (ve *VariableExpr) resolve(r *Resolver) {
 		if declared && !defined {
 			msg := "Can't read local variable in its own initializer."
 			fmt.Fprintf(os.Stderr, "[line %d] Error at '%s': %s\n", ve.name.Line, ve.name.Lexeme, msg)
-			os.Exit(65)
+			exitWithError(65)
 		}
 	}
 
+	r.checkDeclaredLater(ve.name)
 	r.resolveLocal(ve, ve.name.Lexeme)
 }
 
 func (se *SuperExpr) resolve(r *Resolver) {
 	if r.classType == ClassTypeNone {
 		fmt.Fprintf(os.Stderr, "Can't use 'super' outside of a class.")
-		os.Exit(65)
+		exitWithError(65)
 	} else if r.classType != ClassTypeSubclass {
 		fmt.Fprintf(os.Stderr, "Can't use 'super' without a superclass.")
-		os.Exit(65)
+		exitWithError(65)
 	}
 	r.resolveLocal(se, se.keyword.Lexeme)
 }
 
 // Helper functions for resolving
+
+// Records the names a scope will declare, so using one before its declaration
+// is caught instead of silently resolving to an outer variable.
+//
+// This is opt-in, since clox allows it and the test suite depends on it, e.g.
+// printing an outer variable before shadowing it.
+func (r *Resolver) declareLater(stmts []Stmt) {
+	if !r.strictScopes {
+		return
+	}
+
+	later := r.later[len(r.later)-1]
+	for _, stmt := range stmts {
+		switch decl := stmt.(type) {
+		case *VarDecl:
+			later[decl.name] = true
+		case *FunDecl:
+			later[decl.name] = true
+		case *ClassDecl:
+			later[decl.name] = true
+		}
+	}
+}
+
+// Looks through the scopes the way resolveLocal does, stopping at the one the
+// name resolves to. Scopes outside the current function aren't checked, since
+// the function can't be called until after their declarations.
+func (r *Resolver) checkDeclaredLater(name Token) {
+	for i := len(r.scopes) - 1; i >= r.funcScope; i-- {
+		if _, ok := r.scopes[i][name.Lexeme]; ok {
+			return
+		}
+		if r.later[i][name.Lexeme] {
+			msg := fmt.Sprintf("Can't use local variable '%s' before its declaration.", name.Lexeme)
+			fmt.Fprintf(os.Stderr, "[line %d] Error at '%s': %s\n", name.Line, name.Lexeme, msg)
+			exitWithError(65)
+		}
+	}
+}
+
 func (r *Resolver) declare(name string) {
 	if len(r.scopes) == 0 {
 		return
 	}
 
+	delete(r.later[len(r.later)-1], name)
 	scope := r.scopes[len(r.scopes)-1]
 	if _, ok := scope[name]; ok {
 		fmt.Fprintf(os.Stderr, "Already a variable named %s in this scope.", name)
-		os.Exit(65)
+		exitWithError(65)
 	}
 
 	scope[name] = false
 }
 
+// Parameters have a token, so the error can include the line
+func (r *Resolver) declareParam(param Token) {
+	scope := r.scopes[len(r.scopes)-1]
+	if _, ok := scope[param.Lexeme]; ok {
+		msg := "Already a variable with this name in this scope."
+		fmt.Fprintf(os.Stderr, "[line %d] Error at '%s': %s\n", param.Line, param.Lexeme, msg)
+		exitWithError(65)
+	}
+
+	scope[param.Lexeme] = false
+}
+
 func (r *Resolver) define(name string) {
 	if len(r.scopes) == 0 {
 		return
@@ -297,6 +423,28 @@ func (r *Resolver) define(name string) {
 	scope[name] = true
 }
 
+// Globals can be redeclared, so a var can shadow an earlier const there
+func (r *Resolver) setConst(name string, isConst bool) {
+	if len(r.scopes) == 0 {
+		r.globals[name] = isConst
+	} else if isConst {
+		r.consts[len(r.consts)-1][name] = true
+	}
+}
+
+// Finds the scope the name resolves to the same way resolveLocal does.
+//
+// Globals are checked in the order they are declared in the source, so a
+// function assigning to a const global declared after it won't be caught.
+func (r *Resolver) isConst(name string) bool {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if _, ok := r.scopes[i][name]; ok {
+			return r.consts[i][name]
+		}
+	}
+	return r.globals[name]
+}
+
 // The expr *MUST* be a pointer to something that implements the Expr interface
 func (r *Resolver) resolveLocal(expr Expr, name string) {
 	last := len(r.scopes) - 1
@@ -307,4 +455,27 @@ func (r *Resolver) resolveLocal(expr Expr, name string) {
 			return
 		}
 	}
+	r.globalRefs[expr] = true
+}
+
+// The fields are evaluated where the object is, since there is no "this"
+func (oe *ObjectExpr) resolve(r *Resolver) {
+	for _, field := range oe.fields {
+		field.expr.resolve(r)
+	}
+}
+
+// The token of an expression that can be in locals
+func resolvedToken(expr Expr) Token {
+	switch e := expr.(type) {
+	case *VariableExpr:
+		return e.name
+	case *AssignmentExpr:
+		return e.name
+	case *ThisExpr:
+		return e.keyword
+	case *SuperExpr:
+		return e.keyword
+	}
+	return Token{}
 }
@@ -1,6 +1,9 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 func (p *Program) Run(lox *Interpreter) (retVal Object, ret bool) {
 	for _, decl := range p.decls {
@@ -20,11 +23,12 @@ func (c *ClassDecl) Run(lox *Interpreter) (retVal Object, ret bool) {
 			runtimeError("Superclass must be a class.")
 		}
 
-		lox.env = NewEnvironment(lox.env)
+		lox.env = lox.newEnvironment(lox.env)
 		lox.env.Define("super", superclass)
 	}
 
-	loxClass := LoxClass{c.name, superclass, make(map[string]*LoxFunction, len(c.methods))}
+	lox.env.capture()
+	loxClass := LoxClass{c.name, superclass, c.fields, make(map[string]*LoxFunction, len(c.methods)), lox.env, map[string]*LoxFunction{}}
 
 	for _, method := range c.methods {
 		loxClass.methods[method.name] = &LoxFunction{
@@ -38,7 +42,8 @@ func (c *ClassDecl) Run(lox *Interpreter) (retVal Object, ret bool) {
 		lox.env = lox.env.parent
 	}
 
-	lox.env.Assign(c.name, &loxClass)
+	// Back in the environment the class was declared in
+	lox.env.Define(c.name, &loxClass)
 
 	return nil, false
 }
@@ -46,6 +51,7 @@ func (c *ClassDecl) Run(lox *Interpreter) (retVal Object, ret bool) {
 // This runs the function *declaration*, not the function itself, so it just
 // adds it to the environment.
 func (fd *FunDecl) Run(lox *Interpreter) (retVal Object, ret bool) {
+	lox.env.capture()
 	lox.env.Define(fd.name, &LoxFunction{funDecl: fd, closure: lox.env})
 	return nil, false
 }
@@ -78,12 +84,36 @@ func (es *ExprStmt) Run(lox *Interpreter) (retVal Object, ret bool) {
 	return nil, false
 }
 
+func (es *EmptyStmt) Run(lox *Interpreter) (retVal Object, ret bool) {
+	return nil, false
+}
+
+// Several values are printed on one line, separated by spaces
 func (ps *PrintStmt) Run(lox *Interpreter) (retVal Object, ret bool) {
-	fmt.Println(ps.expr.Evaluate(lox))
+	strs := make([]string, len(ps.exprs))
+	for i, expr := range ps.exprs {
+		strs[i] = display(lox, expr.Evaluate(lox), ps.keyword.Line)
+	}
+	fmt.Println(strings.Join(strs, " "))
 	return nil, false
 }
 
+// What print shows for a value, which calls toString if an instance has one
+func display(lox *Interpreter, obj Object, line int) string {
+	if inst, ok := IsInstance(obj); ok {
+		if str, ok := inst.ToString(lox, line); ok {
+			return str
+		}
+	}
+	return stringify(obj)
+}
+
 func (rs *ReturnStmt) Run(lox *Interpreter) (retVal Object, ret bool) {
+	if call, ok := rs.expr.(*CallExpr); ok {
+		callable, args := call.prepare(lox)
+		return &tailCall{callable, args}, true
+	}
+
 	retVal = &LoxNil{}
 	if rs.expr != nil {
 		retVal = rs.expr.Evaluate(lox)
@@ -106,8 +136,34 @@ func (is *IfStmt) Run(lox *Interpreter) (retVal Object, ret bool) {
 	return nil, false
 }
 
+// Each element gets a new scope, so a closure in the body captures that element
+func (fs *ForEachStmt) Run(lox *Interpreter) (retVal Object, ret bool) {
+	list, ok := fs.iterable.Evaluate(lox).(*LoxList)
+	if !ok {
+		runtimeErrorAt(fs.name.Line, "Can only loop over a list.")
+	}
+
+	for _, element := range list.elements {
+		lox.checkTime()
+		lox.NewScope()
+		lox.env.Define(fs.name.Lexeme, element)
+		retVal, ret := fs.body.Run(lox)
+		lox.EndScope()
+		if ret {
+			return retVal, true
+		}
+	}
+	return nil, false
+}
+
+func (id *ImportDecl) Run(lox *Interpreter) (retVal Object, ret bool) {
+	lox.Import(id)
+	return nil, false
+}
+
 func (ws *WhileStmt) Run(lox *Interpreter) (retVal Object, ret bool) {
 	for IsTruthy(ws.condition.Evaluate(lox)) {
+		lox.checkTime()
 		retVal, ret := ws.body.Run(lox)
 		if ret {
 			return retVal, true
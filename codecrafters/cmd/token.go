@@ -1,6 +1,10 @@
 package main
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
 
 type TokenType int
 
@@ -12,6 +16,7 @@ const (
 	RIGHT_BRACE
 	COMMA
 	DOT
+	ELLIPSIS
 	MINUS
 	PLUS
 	SEMICOLON
@@ -44,6 +49,9 @@ const (
 	TRUE
 	VAR
 	WHILE
+	CONST
+	OBJECT
+	IMPORT
 )
 
 var tokens = [...]string{
@@ -54,6 +62,7 @@ var tokens = [...]string{
 	RIGHT_BRACE:   "RIGHT_BRACE",
 	COMMA:         "COMMA",
 	DOT:           "DOT",
+	ELLIPSIS:      "ELLIPSIS",
 	MINUS:         "MINUS",
 	PLUS:          "PLUS",
 	SEMICOLON:     "SEMICOLON",
@@ -86,6 +95,9 @@ var tokens = [...]string{
 	TRUE:          "TRUE",
 	VAR:           "VAR",
 	WHILE:         "WHILE",
+	CONST:         "CONST",
+	OBJECT:        "OBJECT",
+	IMPORT:        "IMPORT",
 }
 
 var reserved = map[string]TokenType{
@@ -105,21 +117,42 @@ var reserved = map[string]TokenType{
 	"true":   TRUE,
 	"var":    VAR,
 	"while":  WHILE,
+	"const":  CONST,
+	"object": OBJECT,
+	"import": IMPORT,
 }
 
 type Token struct {
-	Type TokenType
+	Type TokenType `json:"type"`
 	// The characters matched from the input
-	Lexeme string
+	Lexeme string `json:"lexeme"`
 	// The value which will be used, e.g. 42.0 -> Type: NUMBER, Lexeme: 42.0, Literal: 42
-	Literal string
-	Line    int
+	Literal string `json:"literal"`
+	Line    int    `json:"line"`
+}
+
+// Uses the name, e.g. "LEFT_PAREN", instead of the number
+func (t TokenType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(tokens[t])
 }
 
 func (t Token) String() string {
-	lit := t.Literal
+	lexeme, lit := t.Lexeme, t.Literal
 	if lit == "" {
 		lit = "null"
 	}
-	return fmt.Sprintf("%s %s %s", tokens[t.Type], t.Lexeme, lit)
+	if t.Type == STRING {
+		// Keeps a multi-line string on one line. A backslash is left alone, like
+		// the reference, since Lox has no escape sequences.
+		lexeme = escapes.Replace(lexeme)
+		lit = literalEscapes.Replace(lit)
+	}
+	return fmt.Sprintf("%s %s %s", tokens[t.Type], lexeme, lit)
 }
+
+var escapes = strings.NewReplacer("\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// A quote in the literal is escaped, so it reads the same as in the source. The
+// scanner ends a string at the first quote for now, so this only matters once
+// escape sequences are decoded.
+var literalEscapes = strings.NewReplacer("\n", `\n`, "\r", `\r`, "\t", `\t`, `"`, `\"`)
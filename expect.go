@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/* Builds the expected result from the comments in a test, like the
+ * craftinginterpreters test runner, so the reference doesn't need to be run:
+ *   // expect: <a line of stdout>
+ *   // expect runtime error: <message>      (exits with 70)
+ *   // [line N] Error <message>             (exits with 65)
+ *   // expect exit: <code>                  (for a program that exits itself)
+ * If the line number is left off an error, it is the line of the comment.
+ * Errors only expected from jlox ([java line N]) are ignored.
+ */
+var (
+	expectOutput       = regexp.MustCompile(`// expect: ?(.*)`)
+	expectRuntimeError = regexp.MustCompile(`// expect runtime error: (.+)`)
+	expectSyntaxError  = regexp.MustCompile(`// (\[(?:c )?line (\d+)\] )?(Error.*)`)
+	expectExit         = regexp.MustCompile(`// expect exit: (\d+)`)
+)
+
+func expectedResult(test string) TestResult {
+	contents, err := os.ReadFile(test)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading test: %v\n", err)
+		os.Exit(1)
+	}
+
+	stdout := []string{}
+	stderr := []string{}
+	exitCode := 0
+
+	for i, line := range strings.Split(string(contents), "\n") {
+		if match := expectOutput.FindStringSubmatch(line); match != nil {
+			stdout = append(stdout, match[1]+"\n")
+		} else if match := expectRuntimeError.FindStringSubmatch(line); match != nil {
+			stderr = append(stderr, match[1])
+			exitCode = 70
+		} else if match := expectSyntaxError.FindStringSubmatch(line); match != nil {
+			lineNum := match[2]
+			if lineNum == "" {
+				lineNum = fmt.Sprint(i + 1)
+			}
+			stderr = append(stderr, fmt.Sprintf("[line %s] %s", lineNum, match[3]))
+			exitCode = 65
+		} else if match := expectExit.FindStringSubmatch(line); match != nil {
+			exitCode, _ = strconv.Atoi(match[1])
+		}
+	}
+
+	return TestResult{
+		Stdout:   strings.Join(stdout, ""),
+		Stderr:   strings.Join(stderr, "\n"),
+		ExitCode: exitCode,
+	}
+}
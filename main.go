@@ -1,21 +1,29 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io/fs"
+	"math/rand/v2"
 	"os"
 	"os/exec"
 	"path"
+	"regexp"
 	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
 )
 
 type TestCase struct {
 	Name     string
+	Suite    string // the name of the suite it's in, since names repeat across suites
 	Expected *TestResult
 	Actual   *TestResult
 	Percent  float64
@@ -26,6 +34,7 @@ type TestResult struct {
 	Stderr   string
 	ExitCode int
 	Duration time.Duration
+	TimedOut bool
 }
 
 type TestSuite struct {
@@ -36,31 +45,193 @@ type TestSuite struct {
 type TestFramework struct {
 	Reference string //command to run the reference implementation
 	Target    string //command to run the implementation being tested
+	Compare   Comparison
+	Progress  bool //show which test is running on a line that gets overwritten
+	Shuffle   bool //run the tests in a random order, decided by the Seed
+	FailFast  bool //stop starting tests after the first failure
+	Seed      uint64
 	Suites    []*TestSuite
 	Total     int
 	Failed    []*TestCase
 	Percent   float64 //percent difference time to run
 }
 
+// Decides whether the actual result of a test matches the expected one. Each
+// check is one part of the result, so what differed can be reported with the
+// same checks that decided the test failed.
+type Comparison []Check
+
+type Check struct {
+	Part string //the part of the result checked, e.g. "stdout"
+	Same func(expected, actual *TestResult) bool
+}
+
 var (
+	reference    = flag.String("ref", "test/official-clox", "Command to run the reference implementation.")
+	target       = flag.String("target", "clox/clox_interpreter", "Command to run the implementation being tested.")
 	noFailStderr = flag.Bool("no-fail-stderr", false, "Stderr mis-match is not a failure.")
+	parallel     = flag.Int("parallel", 1, "Number of tests to run at the same time.")
+	runPattern   = flag.String("run", "", "Only run tests whose suite/name matches this regular expression.")
+	timeout      = flag.Duration("timeout", 0, "Kill a test that runs longer than this, e.g. 10s. 0 means no limit.")
+	jsonOutput   = flag.Bool("json", false, "Print the results as JSON instead of a table.")
+	junitPath    = flag.String("junit", "", "Also write a JUnit XML report to this file.")
+	onlyFailed   = flag.Bool("failed", false, "Only run the tests that failed last time.")
+	expectMode   = flag.Bool("expect", false, "Compare against the // expect comments in each test instead of running the reference.")
+	suiteName    = flag.String("suite", "", "Only run the suite with this name, e.g. closure or \"Top Level\".")
+	progress     = flag.Bool("progress", true, "Show which test is running. Never shown when stdout isn't a terminal or with -json.")
+	histogram    = flag.Bool("hist", false, "Print a histogram of the comparative runtimes after the summary.")
+	shuffle      = flag.String("shuffle", "off", "Run the tests in a random order: off, on, or the seed of an order to repeat.")
+	combined     = flag.Bool("combined", false, "Capture stdout and stderr together, so the order they're written in is compared too.")
+	normalizeEOL = flag.Bool("normalize-eol", false, "Treat \\r\\n line endings as \\n in the output.")
+	colorMode    = flag.String("color", "auto", "When to color the output: never, always, or auto (only for a terminal).")
+	failFast     = flag.Bool("fail-fast", false, "Stop after the first failing test, and only report the tests that ran.")
+	widthFlag    = flag.Int("width", 0, "How many columns wide the report is. 0 uses the terminal's width, or 120 when it isn't one.")
 )
 
 func main() {
 	flag.Parse()
+	setColor(*colorMode)
+	setWidth(*widthFlag)
 
 	tf := TestFramework{
-		Reference: "test/official-clox",
-		Target:    "clox/clox_interpreter",
+		Reference: *reference,
+		Target:    *target,
+		Compare:   allOf(sameExitCode, sameStdout, sameStderr),
+		Progress:  showProgress(*progress, *jsonOutput, os.Stdout),
+		FailFast:  *failFast,
+	}
+	if *expectMode {
+		tf.Compare = allOf(sameExitCode, sameStdout, stderrContains)
 	}
+	if *noFailStderr {
+		tf.Compare = allOf(sameExitCode, sameStdout)
+	}
+	tf.setShuffle(*shuffle)
+
+	// The comments don't say how the output and errors interleave
+	if *combined && *expectMode {
+		fmt.Fprintln(os.Stderr, "-combined can't be used with -expect")
+		os.Exit(1)
+	}
+
+	// The reference isn't run when the expected output comes from the tests
+	if !*expectMode {
+		checkExecutable("reference", tf.Reference)
+	}
+	checkExecutable("target", tf.Target)
 
 	tf.collectSuites("test/cases")
+	if *suiteName != "" {
+		tf.filterSuite(*suiteName)
+	}
+	if *runPattern != "" {
+		pattern, err := regexp.Compile(*runPattern)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -run pattern: %v\n", err)
+			os.Exit(1)
+		}
+		tf.filterCases(pattern.MatchString)
+	}
+	if *onlyFailed {
+		if failed, ok := readFailed(); ok {
+			tf.filterCases(func(casePath string) bool { return failed[casePath] })
+		}
+	}
 	slices.SortFunc(tf.Suites, func(a, b *TestSuite) int {
 		return strings.Compare(a.Name, b.Name)
 	})
 
 	tf.executeTests()
-	tf.PrintSummary()
+	tf.writeFailed()
+	if *junitPath != "" {
+		tf.WriteJUnit(*junitPath)
+	}
+	if *jsonOutput {
+		tf.PrintJSON()
+	} else {
+		tf.PrintSummary()
+		if *histogram && timesReference() {
+			tf.PrintHistogram()
+		}
+	}
+
+	// Failed uses the same comparison as the results, so a stderr mis-match
+	// with -no-fail-stderr doesn't fail the run either
+	if len(tf.Failed) > 0 {
+		os.Exit(1)
+	}
+}
+
+// The progress line is overwritten with \r, which only works on a terminal, and
+// would break the JSON
+func showProgress(enabled, json bool, out *os.File) bool {
+	return enabled && !json && isatty.IsTerminal(out.Fd())
+}
+
+// The seed is printed so a failing order can be repeated
+func (tf *TestFramework) setShuffle(mode string) {
+	switch mode {
+	case "off":
+		return
+	case "on":
+		tf.Seed = uint64(time.Now().UnixNano())
+	default:
+		seed, err := strconv.ParseUint(mode, 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -shuffle %q: must be off, on, or a seed\n", mode)
+			os.Exit(1)
+		}
+		tf.Seed = seed
+	}
+	tf.Shuffle = true
+
+	out := os.Stdout
+	if *jsonOutput {
+		out = os.Stderr
+	}
+	fmt.Fprintf(out, "-shuffle %d\n", tf.Seed)
+}
+
+func setColor(mode string) {
+	switch mode {
+	case "never":
+		color.NoColor = true
+	case "always":
+		color.NoColor = false
+	case "auto":
+		color.NoColor = !isatty.IsTerminal(os.Stdout.Fd())
+	default:
+		fmt.Fprintf(os.Stderr, "invalid -color %q: must be never, always, or auto\n", mode)
+		os.Exit(1)
+	}
+}
+
+// Commands can have arguments, e.g. "go run ./codecrafters/cmd run", so only
+// the first word needs to be an executable
+func checkExecutable(name, command string) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		fmt.Fprintf(os.Stderr, "No %s command given\n", name)
+		os.Exit(1)
+	}
+	if _, err := exec.LookPath(fields[0]); err != nil {
+		cantRun(name, fields[0], err)
+	}
+}
+
+// Only one worker reports a command that can't run, the rest are stopped by the exit
+var cantRunOnce sync.Once
+
+// A command can exist and still not start, e.g. one built for another platform,
+// which would fail every test the same way
+func cantRun(name, executable string, err error) {
+	cantRunOnce.Do(func() {
+		fmt.Fprintf(os.Stderr, "Can't run the %s %q: %v\n", name, executable, err)
+		if name == "reference" {
+			fmt.Fprintln(os.Stderr, "Build it, point -ref at it, or use -expect to compare against the // expect comments instead.")
+		}
+		os.Exit(1)
+	})
 }
 
 /* Collect the tests from the files and directories in test/cases
@@ -84,9 +255,95 @@ func (tf *TestFramework) collectSuites(dir string) {
 	tf.Suites = suites
 }
 
+// Only keeps the named suite, or lists the suites if there is none by that name
+func (tf *TestFramework) filterSuite(name string) {
+	for _, suite := range tf.Suites {
+		if suite.Name == name {
+			tf.Suites = []*TestSuite{suite}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "No suite named %q. The suites are:\n", name)
+	for _, suite := range tf.Suites {
+		fmt.Fprintf(os.Stderr, "  %s\n", suite.Name)
+	}
+	os.Exit(1)
+}
+
+// Only keeps the cases whose path is kept, and drops any suites left empty
+func (tf *TestFramework) filterCases(keep func(casePath string) bool) {
+	for _, suite := range tf.Suites {
+		suite.Cases = slices.DeleteFunc(suite.Cases, func(tc TestCase) bool {
+			return !keep(suite.casePath(tc.Name))
+		})
+	}
+	tf.Suites = slices.DeleteFunc(tf.Suites, func(suite *TestSuite) bool {
+		return len(suite.Cases) == 0
+	})
+}
+
+// The path of a case relative to test/cases, e.g. "closure/nested_closure.lox"
+func (suite *TestSuite) casePath(name string) string {
+	return casePath(suite.Name, name)
+}
+
+// The path a case is matched by with -run, and saved as for -failed
+func (tc TestCase) casePath() string {
+	return casePath(tc.Suite, tc.Name)
+}
+
+func casePath(suite, name string) string {
+	if suite == "Top Level" {
+		return name
+	}
+	return path.Join(suite, name)
+}
+
+/* The paths of the cases that failed are saved after every run, so they can be
+ * re-run with -failed. If there is no file, every test is run.
+ */
+const failedFile = ".loxtest-failed"
+
+func readFailed() (map[string]bool, bool) {
+	contents, err := os.ReadFile(failedFile)
+	if err != nil {
+		return nil, false
+	}
+
+	failed := map[string]bool{}
+	for _, line := range strings.Split(string(contents), "\n") {
+		if line != "" {
+			failed[line] = true
+		}
+	}
+	return failed, true
+}
+
+func (tf TestFramework) writeFailed() {
+	sb := strings.Builder{}
+	for _, suite := range tf.Suites {
+		if suite.Name == "benchmark" {
+			continue
+		}
+		for _, tc := range suite.Cases {
+			if !tc.Passed(tf.Compare) {
+				sb.WriteString(suite.casePath(tc.Name) + "\n")
+			}
+		}
+	}
+
+	if err := os.WriteFile(failedFile, []byte(sb.String()), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "error saving failed tests: %v\n", err)
+	}
+}
+
 func getEntries(dir string) []fs.DirEntry {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
+		// The paths are relative, so this is usually being run from the wrong place
+		fmt.Fprintf(os.Stderr, "Can't read the tests: %v\n", err)
+		fmt.Fprintln(os.Stderr, "Run the harness from the root of the repository.")
 		os.Exit(1)
 	}
 	return entries
@@ -105,12 +362,18 @@ func collectSuite(dir string) *TestSuite {
 /* These run the tests. It ignores the test in the benchmark test suite because
  * those tests print out how long the test took, which even using the same VM
  * will produce different results.
+ *
+ * All of the tests are run before any results are printed, so they can be run
+ * in parallel and still be printed grouped by suite, in order.
  */
-const WIDTH = 120
+// A test case to run and the path to its file
+type job struct {
+	tc   *TestCase
+	path string
+}
 
 func (tf *TestFramework) executeTests() {
-	first := true
-
+	jobs := []job{}
 	for _, suite := range tf.Suites {
 		if suite.Name == "benchmark" {
 			continue
@@ -118,6 +381,136 @@ func (tf *TestFramework) executeTests() {
 			// the same output
 		}
 
+		for i, testCase := range suite.Cases {
+			suite.Cases[i].Suite = suite.Name
+			testPath := path.Join("test/cases", suite.casePath(testCase.Name))
+			jobs = append(jobs, job{&suite.Cases[i], testPath})
+		}
+	}
+
+	// Only the order they run in changes, the results are still in order
+	if tf.Shuffle {
+		rng := rand.New(rand.NewPCG(tf.Seed, 0))
+		rng.Shuffle(len(jobs), func(i, j int) {
+			jobs[i], jobs[j] = jobs[j], jobs[i]
+		})
+	}
+
+	tf.runJobs(jobs, max(*parallel, 1))
+	if *jsonOutput {
+		tf.recordResults()
+	} else {
+		tf.printResults()
+	}
+
+	if tf.Total > 0 {
+		tf.Percent /= float64(tf.Total)
+	}
+}
+
+// Runs the jobs through a pool of workers, filling in each TestCase's results
+func (tf *TestFramework) runJobs(jobs []job, workers int) {
+	queue := make(chan job)
+	started := make(chan job)
+	done := make(chan job)
+
+	// With -fail-fast, a failure closes stop so no more jobs are started, but
+	// the jobs already running still finish
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	stopped := false
+
+	go func() {
+		defer close(queue)
+		for _, j := range jobs {
+			select {
+			case queue <- j:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				select {
+				case <-stop:
+					continue
+				default:
+				}
+				started <- j
+				var expected TestResult
+				if *expectMode {
+					expected = expectedResult(j.path)
+				} else {
+					expected = executeTest("reference", tf.Reference, j.path)
+				}
+				target := executeTest("target", tf.Target, j.path)
+				if *normalizeEOL {
+					// Before comparing, so the diffs show what was compared
+					expected.normalizeEOL()
+					target.normalizeEOL()
+				}
+				j.tc.Expected = &expected
+				j.tc.Actual = &target
+				j.tc.Percent = float64(expected.Duration.Nanoseconds()) / float64(target.Duration.Nanoseconds()) * 100
+				if tf.FailFast && !j.tc.Passed(tf.Compare) {
+					stopOnce.Do(func() {
+						stopped = true
+						close(stop)
+					})
+				}
+				done <- j
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	// Only this goroutine prints, so the progress line doesn't get garbled
+	numStarted := 0
+	for running := true; running; {
+		select {
+		case j := <-started:
+			numStarted++
+			tf.printProgress(numStarted, len(jobs), strings.TrimPrefix(j.path, "test/cases/"))
+		case _, running = <-done:
+		}
+	}
+	tf.clearProgress()
+
+	if stopped {
+		tf.dropUnrun()
+	}
+}
+
+// Only the cases that ran are printed and counted in the summary
+func (tf *TestFramework) dropUnrun() {
+	for _, suite := range tf.Suites {
+		suite.Cases = slices.DeleteFunc(suite.Cases, func(tc TestCase) bool {
+			return tc.Actual == nil
+		})
+	}
+	tf.Suites = slices.DeleteFunc(tf.Suites, func(suite *TestSuite) bool {
+		return len(suite.Cases) == 0
+	})
+}
+
+func (tf *TestFramework) printResults() {
+	first := true
+
+	for _, suite := range tf.Suites {
+		if suite.Name == "benchmark" {
+			continue
+		}
+
 		if first {
 			first = false
 		} else {
@@ -126,56 +519,77 @@ func (tf *TestFramework) executeTests() {
 
 		// Width of 9 for percent to take into account the '%'
 		columns := fmt.Sprintf("%12s %12s %8s", "reference", "actual", "percent")
-		spacing := strings.Repeat(" ", (WIDTH)-len(suite.Name)-len(columns))
+		if !timesReference() {
+			columns = fmt.Sprintf("%12s", "actual")
+		}
+		spacing := strings.Repeat(" ", max(width-len(suite.Name)-len(columns), 1))
 		fmt.Printf("%s%s%s\n", suite.Name, spacing, columns)
 
 		prevFailed := false
-		for i, testCase := range suite.Cases {
-			testPath := path.Join("test/cases", suite.Name, testCase.Name)
-			if suite.Name == "Top Level" {
-				testPath = path.Join("test/cases", testCase.Name)
-			}
-
+		for i := range suite.Cases {
 			tc := &suite.Cases[i]
-
-			expected := executeTest(tf.Reference, testPath)
-			target := executeTest(tf.Target, testPath)
-			tc.Expected = &expected
-			tc.Actual = &target
-			tc.Percent = float64(expected.Duration.Nanoseconds()) / float64(target.Duration.Nanoseconds()) * 100
-
-			prevFailed = tc.PrintResult(prevFailed)
-
-			tf.Total++
-			tf.Percent += tc.Percent
-			if prevFailed {
-				tf.Failed = append(tf.Failed, tc)
-			}
+			prevFailed = tc.PrintResult(prevFailed, tf.Compare)
+			tf.record(tc, prevFailed)
 		}
 	}
+}
 
-	tf.Percent /= float64(tf.Total)
+// Adds a finished case to the totals for the summary
+func (tf *TestFramework) record(tc *TestCase, failed bool) {
+	tf.Total++
+	tf.Percent += tc.Percent
+	if failed {
+		tf.Failed = append(tf.Failed, tc)
+	}
 }
 
-func executeTest(executable, test string) TestResult {
+// Each run gets its own timeout, so the reference and target are timed
+// independently of each other.
+func executeTest(name, executable, test string) TestResult {
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
 	command := strings.Fields(executable)
 	command = append(command, test)
-	cmd := exec.Command(command[0], command[1:]...)
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.WaitDelay = time.Second // in case the killed process left its output open
 	stdout := strings.Builder{}
 	stderr := strings.Builder{}
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
+	if *combined {
+		// exec only lets one of them write at a time when they're the same
+		// writer, and everything ends up in Stdout
+		cmd.Stderr = &stdout
+	}
 
 	start := time.Now()
 	err := cmd.Run()
 	duration := time.Since(start)
 
+	if ctx.Err() == context.DeadlineExceeded {
+		return TestResult{
+			Stdout:   stdout.String(),
+			Stderr:   "TIMEOUT",
+			ExitCode: -1,
+			Duration: duration,
+			TimedOut: true,
+		}
+	}
+
 	exitCode := 0
 	if err != nil {
 		if exitError, ok := err.(*exec.ExitError); ok {
 			exitCode = exitError.ExitCode()
+		} else if errors.Is(err, exec.ErrWaitDelay) {
+			// It ran, but something it started kept the output open
+			exitCode = cmd.ProcessState.ExitCode()
 		} else {
-			fmt.Fprintf(os.Stderr, "execution error: %v", err)
+			cantRun(name, command[0], err)
 		}
 	}
 
@@ -187,37 +601,109 @@ func executeTest(executable, test string) TestResult {
 	}
 }
 
+func (tr *TestResult) normalizeEOL() {
+	tr.Stdout = strings.ReplaceAll(tr.Stdout, "\r\n", "\n")
+	tr.Stderr = strings.ReplaceAll(tr.Stderr, "\r\n", "\n")
+}
+
+/* The progress line is only shown on a terminal, since carriage returns would
+ * clutter a log file. It must be cleared before anything else is printed.
+ */
+func (tf *TestFramework) printProgress(n, total int, name string) {
+	if !tf.Progress {
+		return
+	}
+	digits := len(fmt.Sprint(total))
+	fmt.Printf("\r[ %*d/%d ] running %s", digits, n, total, name)
+}
+
+func (tf *TestFramework) clearProgress() {
+	if !tf.Progress {
+		return
+	}
+	fmt.Print("\r\033[K")
+}
+
 /* These compare and print the test results.
  * If there is a difference in the output or error output, it will print them
- * side-by-side based on the WIDTH.
+ * side-by-side based on the width.
  * It also prints out how long each version took to execute and the difference
  * in how long the tested implementation took to run the same test.
  */
-var divider = strings.Repeat("-", WIDTH)
-var headerSpacing = strings.Repeat(" ", (WIDTH/2)-len("Expected stdout"))
+var (
+	width   = 120
+	divider = strings.Repeat("-", width)
+	// Each side of a diff, leaving room for the gutter and the separator
+	column = width/2 - 1
+)
+
+// Narrower than this and the names and timings don't fit on a line
+const minWidth = 60
+
+func setWidth(n int) {
+	if n == 0 {
+		if cols, ok := terminalWidth(); ok {
+			n = max(cols, minWidth)
+		} else {
+			n = width
+		}
+	}
+	if n < minWidth {
+		fmt.Fprintf(os.Stderr, "invalid -width %d: must be at least %d\n", n, minWidth)
+		os.Exit(1)
+	}
+
+	width = n
+	divider = strings.Repeat("-", width)
+	column = width/2 - 1
+}
+
+// With -expect the reference isn't run, so there is nothing to compare the
+// target's times to
+func timesReference() bool {
+	return !*expectMode
+}
+
+// A hung target always fails, even if the reference hung too
+func (tc TestCase) Passed(compare Comparison) bool {
+	return !tc.Actual.TimedOut && compare.Passes(tc.Expected, tc.Actual)
+}
 
 // Creates the summary line and whether the result differes
-func (tc TestCase) summaryVars() (string, bool) {
-	succeeded := tc.Expected.ExitCode == tc.Actual.ExitCode &&
-		tc.Expected.Stdout == tc.Actual.Stdout &&
-		(tc.Expected.Stderr == tc.Actual.Stderr || *noFailStderr)
+func (tc TestCase) summaryVars(compare Comparison) (string, bool) {
+	succeeded := tc.Passed(compare)
 
 	result := color.GreenString("passed")
+	name := tc.Name
 	if !succeeded {
 		result = color.RedString("failed")
+		// The full path, so a failure can be found and rerun from this line alone
+		name = tc.casePath() + " (" + strings.Join(tc.differences(compare), ", ") + ")"
 	}
 
 	timing := fmt.Sprintf("%12s %12s %7.2f%%", tc.Expected.Duration, tc.Actual.Duration, tc.Percent)
+	if !timesReference() {
+		timing = fmt.Sprintf("%12s", tc.Actual.Duration)
+	}
 
 	// Spacing works because len("passed") == len("failed")
-	resultSpacing := strings.Repeat(" ", WIDTH-len("  [passed] ")-len(tc.Name)-len(timing))
+	resultSpacing := strings.Repeat(" ", max(width-len("  [passed] ")-len(name)-len(timing), 1))
 
-	summary := fmt.Sprintf("  [%s] %s%s%s", result, tc.Name, resultSpacing, timing)
+	summary := fmt.Sprintf("  [%s] %s%s%s", result, name, resultSpacing, timing)
 	return summary, !succeeded
 }
 
-func (tc TestCase) PrintResult(prevFailed bool) bool {
-	summary, failed := tc.summaryVars()
+// Which parts of the result didn't match, including a timeout
+func (tc TestCase) differences(compare Comparison) []string {
+	diffs := []string{}
+	if tc.Actual.TimedOut {
+		diffs = append(diffs, "timeout")
+	}
+	return append(diffs, compare.Differences(tc.Expected, tc.Actual)...)
+}
+
+func (tc TestCase) PrintResult(prevFailed bool, compare Comparison) bool {
+	summary, failed := tc.summaryVars(compare)
 
 	if failed && !prevFailed {
 		// Don't print the divider twice for two errors in a row
@@ -225,16 +711,20 @@ func (tc TestCase) PrintResult(prevFailed bool) bool {
 	}
 	fmt.Println(summary)
 
-	if tc.Expected.ExitCode != tc.Actual.ExitCode {
-		fmt.Printf("Expected exit code %d, but got %d\n", tc.Expected.ExitCode, tc.Actual.ExitCode)
-	}
-	if tc.Expected.Stdout != tc.Actual.Stdout {
-		fmt.Printf("Expected stdout%sActual stdout\n", headerSpacing)
-		printDiff(tc.Expected.Stdout, tc.Actual.Stdout)
-	}
-	if !*noFailStderr && tc.Expected.Stderr != tc.Actual.Stderr {
-		fmt.Printf("Expected stderr%sActual stderr\n", headerSpacing)
-		printDiff(tc.Expected.Stderr, tc.Actual.Stderr)
+	// Only what the comparison checks is shown, so a passing test has no diffs
+	for _, part := range tc.differences(compare) {
+		switch part {
+		case "timeout":
+			fmt.Printf("Timed out after %s\n", *timeout)
+		case "exit":
+			fmt.Printf("Expected exit code %d, but got %d\n", tc.Expected.ExitCode, tc.Actual.ExitCode)
+		case "stdout":
+			fmt.Printf(" %-*s %s\n", column, "Expected stdout", "Actual stdout")
+			printDiff(tc.Expected.Stdout, tc.Actual.Stdout)
+		case "stderr":
+			fmt.Printf(" %-*s %s\n", column, "Expected stderr", "Actual stderr")
+			printDiff(tc.Expected.Stderr, tc.Actual.Stderr)
+		}
 	}
 
 	if failed {
@@ -243,33 +733,134 @@ func (tc TestCase) PrintResult(prevFailed bool) bool {
 	return failed
 }
 
+/* Comparisons are composed from checks with allOf, so each mode of comparing
+ * only has to pick which checks it uses.
+ */
+var (
+	sameExitCode = Check{"exit", func(expected, actual *TestResult) bool {
+		return expected.ExitCode == actual.ExitCode
+	}}
+	sameStdout = Check{"stdout", func(expected, actual *TestResult) bool {
+		return expected.Stdout == actual.Stdout
+	}}
+	sameStderr = Check{"stderr", func(expected, actual *TestResult) bool {
+		return expected.Stderr == actual.Stderr
+	}}
+	// The expected stderr only has the error messages, not the rest of the trace
+	stderrContains = Check{"stderr", func(expected, actual *TestResult) bool {
+		for _, line := range strings.Split(expected.Stderr, "\n") {
+			if !strings.Contains(actual.Stderr, line) {
+				return false
+			}
+		}
+		return true
+	}}
+)
+
+// Passes only if every check passes
+func allOf(checks ...Check) Comparison {
+	return Comparison(checks)
+}
+
+func (compare Comparison) Passes(expected, actual *TestResult) bool {
+	return len(compare.Differences(expected, actual)) == 0
+}
+
+// The parts of the result whose checks failed, in the order they're checked
+func (compare Comparison) Differences(expected, actual *TestResult) []string {
+	parts := []string{}
+	for _, check := range compare {
+		if !check.Same(expected, actual) {
+			parts = append(parts, check.Part)
+		}
+	}
+	return parts
+}
+
+// Lines that differ are marked with a '*' in the gutter
 func printDiff(expected, actual string) {
 	expectedLines := strings.Split(expected, "\n")
 	actualLines := strings.Split(actual, "\n")
 
-	for i := 0; i < len(expectedLines) && i < len(actualLines); i++ {
-		spaces := (WIDTH / 2) - len(expectedLines[i])
-		if spaces < 0 {
-			spaces = 2
+	for i := range max(len(expectedLines), len(actualLines)) {
+		e, a := "", ""
+		if i < len(expectedLines) {
+			e = expectedLines[i]
+		}
+		if i < len(actualLines) {
+			a = actualLines[i]
+		}
+
+		gutter := ' '
+		if e != a {
+			gutter = '*'
 		}
-		spacing := strings.Repeat(" ", spaces)
-		fmt.Printf("%s%s%s\n", expectedLines[i], spacing, actualLines[i])
+		fmt.Printf("%c%-*s|%s\n", gutter, column, fitColumn(e), fitColumn(a))
+	}
+}
+
+// Long lines are cut off so the columns stay lined up
+func fitColumn(line string) string {
+	if len(line) <= column {
+		return line
 	}
+	return line[:column-3] + "..."
 }
 
 func (tf TestFramework) PrintSummary() {
 	fmt.Println()
-	fmt.Println(strings.Repeat("=", WIDTH))
+	fmt.Println(strings.Repeat("=", width))
 
 	fmt.Println("Test summary")
 	fmt.Printf("Tests run: %d\n", tf.Total)
 	fmt.Printf("Succeeded: %d\n", tf.Total-len(tf.Failed))
 	fmt.Printf("Failed:    %d\n", len(tf.Failed))
-	fmt.Printf("Average comparative runtime: %7.2f%%\n", tf.Percent)
+	if timesReference() {
+		fmt.Printf("Average comparative runtime: %7.2f%%\n", tf.Percent)
+	}
 
 	fmt.Println()
 	fmt.Println("Failed tests:")
 	for _, tc := range tf.Failed {
-		fmt.Printf("  %s\n", tc.Name)
+		fmt.Printf("  %s\n", tc.casePath())
+	}
+}
+
+/* The comparative runtimes are bucketed every 25%, with everything past 200%
+ * in the last bucket. Under 100% means the target was slower than the
+ * reference. The bars are scaled so the biggest bucket fills the width.
+ */
+const (
+	bucketSize = 25
+	numBuckets = 200/bucketSize + 1
+)
+
+func (tf TestFramework) PrintHistogram() {
+	counts := [numBuckets]int{}
+	for _, suite := range tf.Suites {
+		if suite.Name == "benchmark" {
+			continue
+		}
+		for _, tc := range suite.Cases {
+			bucket := min(int(tc.Percent)/bucketSize, numBuckets-1)
+			counts[bucket]++
+		}
+	}
+
+	most := slices.Max(counts[:])
+	if most == 0 {
+		return
+	}
+	barWidth := width - 24
+
+	fmt.Println()
+	fmt.Println("Comparative runtime histogram:")
+	for i, count := range counts {
+		label := fmt.Sprintf("%d-%d%%", i*bucketSize, (i+1)*bucketSize)
+		if i == numBuckets-1 {
+			label = fmt.Sprintf("%d%%+", i*bucketSize)
+		}
+		bar := strings.Repeat("#", count*barWidth/most)
+		fmt.Printf("  %10s %5d %s\n", label, count, bar)
 	}
 }
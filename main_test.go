@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAllOfComposesChecks(t *testing.T) {
+	expected := &TestResult{Stdout: "1\n", Stderr: "Undefined variable 'x'.", ExitCode: 70}
+	compare := allOf(sameExitCode, sameStdout)
+
+	tests := []struct {
+		name   string
+		actual *TestResult
+		diffs  []string
+	}{
+		{"both match", &TestResult{Stdout: "1\n", ExitCode: 70}, []string{}},
+		{"exit differs", &TestResult{Stdout: "1\n", ExitCode: 0}, []string{"exit"}},
+		{"stdout differs", &TestResult{Stdout: "2\n", ExitCode: 70}, []string{"stdout"}},
+		{"both differ", &TestResult{Stdout: "2\n", ExitCode: 65}, []string{"exit", "stdout"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diffs := compare.Differences(expected, test.actual)
+			if !slices.Equal(diffs, test.diffs) {
+				t.Errorf("Differences() = %v, want %v", diffs, test.diffs)
+			}
+			if passes := compare.Passes(expected, test.actual); passes != (len(test.diffs) == 0) {
+				t.Errorf("Passes() = %v with differences %v", passes, test.diffs)
+			}
+		})
+	}
+}
+
+// The stderr isn't checked at all unless a stderr check is composed in
+func TestAllOfOnlyUsesItsChecks(t *testing.T) {
+	expected := &TestResult{Stderr: "Undefined variable 'x'.", ExitCode: 70}
+	actual := &TestResult{Stderr: "Undefined variable 'x'.\n[line 1]", ExitCode: 70}
+
+	if !allOf(sameExitCode, sameStdout).Passes(expected, actual) {
+		t.Error("without a stderr check, a different stderr should pass")
+	}
+	if allOf(sameExitCode, sameStderr).Passes(expected, actual) {
+		t.Error("sameStderr should fail when the trace differs")
+	}
+	if !allOf(sameExitCode, stderrContains).Passes(expected, actual) {
+		t.Error("stderrContains should pass when the message is in the trace")
+	}
+}
+
+// What's shown for a test comes from the same checks that passed or failed it
+func TestDifferencesUseTheComparison(t *testing.T) {
+	tc := TestCase{
+		Expected: &TestResult{Stderr: "Undefined variable 'x'.", ExitCode: 70},
+		Actual:   &TestResult{Stderr: "Undefined variable 'x'.\n[line 1]", ExitCode: 70},
+	}
+	compare := allOf(sameExitCode, sameStdout, stderrContains)
+	if !tc.Passed(compare) {
+		t.Fatal("expected the test to pass")
+	}
+	if diffs := tc.differences(compare); len(diffs) != 0 {
+		t.Errorf("a passing test has differences %v", diffs)
+	}
+	if details := tc.failureDetails(compare); details != "" {
+		t.Errorf("a passing test has failure details %q", details)
+	}
+}
+
+func TestProgressOnlyOnATerminal(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if showProgress(true, false, w) {
+		t.Error("progress shown when stdout is a pipe")
+	}
+	if showProgress(true, true, w) {
+		t.Error("progress shown with -json")
+	}
+	if showProgress(false, false, w) {
+		t.Error("progress shown with -progress=false")
+	}
+
+	// Only checked when the tests are run from a terminal
+	if tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0); err == nil {
+		defer tty.Close()
+		if !showProgress(true, false, tty) {
+			t.Error("progress not shown on a terminal")
+		}
+		if showProgress(true, true, tty) {
+			t.Error("progress shown on a terminal with -json")
+		}
+	}
+}
+
+func TestExpectedExitCode(t *testing.T) {
+	result := expectedResult("codecrafters/scripts/exit_code.lox")
+	if result.ExitCode != 3 || result.Stdout != "before\n" {
+		t.Errorf("expectedResult() = exit %d, stdout %q, want exit 3, stdout %q", result.ExitCode, result.Stdout, "before\n")
+	}
+}
+
+// A failed line names the whole path, so it can be rerun without its suite heading
+func TestSummaryNamesTheFailedPath(t *testing.T) {
+	tc := TestCase{
+		Suite:    "closure",
+		Name:     "nested.lox",
+		Expected: &TestResult{Stdout: "1\n"},
+		Actual:   &TestResult{Stdout: "2\n"},
+	}
+	summary, failed := tc.summaryVars(allOf(sameExitCode, sameStdout))
+	if !failed {
+		t.Fatal("expected the test to fail")
+	}
+	if !strings.Contains(summary, "closure/nested.lox (stdout)") {
+		t.Errorf("summary %q doesn't name the test's path", summary)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+/* A machine-readable version of the results and summary, for CI. It replaces
+ * the tables printed by printResults and PrintSummary, and is one document so
+ * it can be parsed in one go.
+ */
+const maxOutputLen = 1000 //stdout and stderr are truncated to this many bytes
+
+type jsonResult struct {
+	Suite          string  `json:"suite"`
+	Name           string  `json:"name"`
+	Passed         bool    `json:"passed"`
+	ExpectedExit   int     `json:"expected_exit"`
+	ActualExit     int     `json:"actual_exit"`
+	ExpectedStdout string  `json:"expected_stdout"`
+	ActualStdout   string  `json:"actual_stdout"`
+	ExpectedStderr string  `json:"expected_stderr"`
+	ActualStderr   string  `json:"actual_stderr"`
+	ExpectedMs     float64 `json:"expected_ms"`
+	ActualMs       float64 `json:"actual_ms"`
+	Percent        float64 `json:"percent"`
+}
+
+type jsonReport struct {
+	Results []jsonResult `json:"results"`
+	Summary jsonSummary  `json:"summary"`
+}
+
+type jsonSummary struct {
+	Total       int      `json:"total"`
+	Succeeded   int      `json:"succeeded"`
+	Failed      int      `json:"failed"`
+	Percent     float64  `json:"average_percent"`
+	FailedTests []string `json:"failed_tests"`
+}
+
+// Counts the results for the summary, without printing the tables
+func (tf *TestFramework) recordResults() {
+	for _, suite := range tf.Suites {
+		if suite.Name == "benchmark" {
+			continue
+		}
+		for i := range suite.Cases {
+			tc := &suite.Cases[i]
+			tf.record(tc, !tc.Passed(tf.Compare))
+		}
+	}
+}
+
+func (tf TestFramework) PrintJSON() {
+	results := []jsonResult{}
+
+	for _, suite := range tf.Suites {
+		if suite.Name == "benchmark" {
+			continue
+		}
+
+		for _, tc := range suite.Cases {
+			passed := tc.Passed(tf.Compare)
+			results = append(results, jsonResult{
+				Suite:          suite.Name,
+				Name:           tc.Name,
+				Passed:         passed,
+				ExpectedExit:   tc.Expected.ExitCode,
+				ActualExit:     tc.Actual.ExitCode,
+				ExpectedStdout: truncate(tc.Expected.Stdout),
+				ActualStdout:   truncate(tc.Actual.Stdout),
+				ExpectedStderr: truncate(tc.Expected.Stderr),
+				ActualStderr:   truncate(tc.Actual.Stderr),
+				ExpectedMs:     milliseconds(tc.Expected.Duration),
+				ActualMs:       milliseconds(tc.Actual.Duration),
+				Percent:        tc.Percent,
+			})
+		}
+	}
+
+	summary := jsonSummary{
+		Total:       tf.Total,
+		Succeeded:   tf.Total - len(tf.Failed),
+		Failed:      len(tf.Failed),
+		Percent:     tf.Percent,
+		FailedTests: []string{},
+	}
+	for _, tc := range tf.Failed {
+		summary.FailedTests = append(summary.FailedTests, tc.casePath())
+	}
+
+	printJSON(jsonReport{results, summary})
+}
+
+func printJSON(v any) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		fmt.Fprintf(os.Stderr, "error encoding JSON: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func truncate(s string) string {
+	if len(s) <= maxOutputLen {
+		return s
+	}
+	return s[:maxOutputLen] + "..."
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / 1e6
+}
+
+/* JUnit XML, which most CI systems can display. Each TestSuite is a
+ * <testsuite>, and each TestCase is a <testcase> with a <failure> describing
+ * what differed. Times are in seconds.
+ */
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     float64          `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     float64         `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Details string `xml:",chardata"`
+}
+
+func (tf TestFramework) WriteJUnit(filename string) {
+	report := junitTestSuites{}
+
+	for _, suite := range tf.Suites {
+		if suite.Name == "benchmark" {
+			continue
+		}
+
+		js := junitTestSuite{Name: suite.Name}
+		for _, tc := range suite.Cases {
+			jc := junitTestCase{
+				Name:      tc.Name,
+				Classname: suite.Name,
+				Time:      tc.Actual.Duration.Seconds(),
+			}
+			if !tc.Passed(tf.Compare) {
+				jc.Failure = &junitFailure{Message: "output differs from the reference", Details: tc.failureDetails(tf.Compare)}
+				js.Failures++
+			}
+
+			js.Tests++
+			js.Time += jc.Time
+			js.Cases = append(js.Cases, jc)
+		}
+
+		report.Tests += js.Tests
+		report.Failures += js.Failures
+		report.Time += js.Time
+		report.Suites = append(report.Suites, js)
+	}
+
+	out, err := xml.MarshalIndent(report, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filename, append([]byte(xml.Header), append(out, '\n')...), 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error writing JUnit report: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Describes each part of the result that the comparison found differs
+func (tc TestCase) failureDetails(compare Comparison) string {
+	sb := strings.Builder{}
+	for _, part := range tc.differences(compare) {
+		switch part {
+		case "timeout":
+			fmt.Fprintf(&sb, "Timed out after %s\n", *timeout)
+		case "exit":
+			fmt.Fprintf(&sb, "Expected exit code %d, but got %d\n", tc.Expected.ExitCode, tc.Actual.ExitCode)
+		case "stdout":
+			fmt.Fprintf(&sb, "Expected stdout:\n%s\nActual stdout:\n%s\n", tc.Expected.Stdout, tc.Actual.Stdout)
+		case "stderr":
+			fmt.Fprintf(&sb, "Expected stderr:\n%s\nActual stderr:\n%s\n", tc.Expected.Stderr, tc.Actual.Stderr)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// Only Unix terminals are asked for their size, everywhere else uses the default
+func terminalWidth() (int, bool) {
+	return 0, false
+}